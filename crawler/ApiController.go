@@ -47,6 +47,24 @@ func (a *ApiController) SaveResult(result *queries.Result) error {
 	return err
 }
 
+func (a *ApiController) SaveIndicators(indicators []*queries.Indicator) error {
+	jsonString, err := json.Marshal(indicators)
+	if err != nil {
+		return err
+	}
+	_, err = a.newRequest("POST", "/indicators", bytes.NewReader(jsonString))
+	return err
+}
+
+func (a *ApiController) SaveHostStats(stats *queries.HostStats) error {
+	jsonString, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = a.newRequest("POST", "/hosts/stats", bytes.NewReader(jsonString))
+	return err
+}
+
 func (a *ApiController) GetQueries() ([]queries.Query, error) {
 	body, err := a.newRequest("GET", "/queries", nil)
 	if err != nil {
@@ -61,6 +79,34 @@ func (a *ApiController) GetQueries() ([]queries.Query, error) {
 	return queries, nil
 }
 
+func (a *ApiController) GetCrawlRules() ([]queries.CrawlRule, error) {
+	body, err := a.newRequest("GET", "/rules", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []queries.CrawlRule
+	err = json.Unmarshal(body, &rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (a *ApiController) GetBlocklist() (*queries.Blocklist, error) {
+	body, err := a.newRequest("GET", "/blocklist", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &queries.Blocklist{}
+	err = json.Unmarshal(body, list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
 func (a *ApiController) newRequest(method, url string, reader io.Reader) ([]byte, error) {
 	key := "wQMXWVm4Yab_SKRISvmbWtbWmuMwud7oVRA0JUYThNAYDN8XS8KG4I0uOAOhRUB43rGtbn4VOhyVds-OIseAHwDOUpex0aESRHXz03jbOdSvLRQN-_qTFYqvcU3paXFAEXMz48a7VlB"
 	user := "crawler"
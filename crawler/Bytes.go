@@ -4,11 +4,11 @@ import (
 	"io"
 )
 
-/// Lees maximum de eerste 512 bytes van deze reader.
-func readFirstBytes(r io.Reader) ([]byte, error) {
-	b := make([]byte, 512, 512)
-	n, err := r.Read(b)
-	if err == io.EOF {
+/// Lees maximum de eerste size bytes van deze reader.
+func readFirstBytes(r io.Reader, size int) ([]byte, error) {
+	b := make([]byte, size, size)
+	n, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
 		// done, maar snij onze byte slice bij om lege (niet ingelezen)
 		// bytes te verwijderen
 		return b[:n], nil
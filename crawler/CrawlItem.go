@@ -12,6 +12,12 @@ import (
 const crawlItemTimeFormat = "2006-01-02-15:04:05.999999999"
 const maxFailCount = 6
 
+// Aantal kolommen in SaveToString. Oudere bestanden hebben er 8, 12 of 13
+const crawlItemColumns = 14
+const crawlItemOldColumns = 8
+const crawlItemValidatorColumns = 12
+const crawlItemIntervalColumns = 13
+
 type CrawlItem struct {
 	URL    *url.URL
 	Depth  int
@@ -26,6 +32,23 @@ type CrawlItem struct {
 	// nodig voor intrudction points
 	LastDownload *time.Time
 
+	// Validators van de laatste download voor conditionele recrawls
+	ETag         string
+	LastModified string
+
+	// Hash van de inhoud bij de laatste download (hex)
+	ContentHash string
+
+	// Versie van de queries die op deze inhoud uitgevoerd werden (zie Crawler.QueryVersion)
+	QueryVersion string
+
+	// Links van de laatste download, nodig om een 304 te kunnen verwerken.
+	// Enkel bijgehouden als de server ETag of Last-Modified meestuurt
+	Links []string
+
+	// Geschat interval tussen twee wijzigingen van de inhoud (0 = nog niet gekend)
+	ChangeInterval time.Duration
+
 	// Positie in de queue (enkel aanpassen in CrawlQueue!)
 	Next     *CrawlItem
 	Previous *CrawlItem
@@ -67,6 +90,14 @@ func (c *CrawlItem) IsEqual(b *CrawlItem) bool {
 		return false
 	}
 
+	if c.ETag != b.ETag || c.LastModified != b.LastModified || c.ContentHash != b.ContentHash || c.QueryVersion != b.QueryVersion || c.ChangeInterval != b.ChangeInterval {
+		return false
+	}
+
+	if strings.Join(c.Links, " ") != strings.Join(b.Links, " ") {
+		return false
+	}
+
 	if !(c.Subdomain == nil && b.Subdomain == nil) && (c.Subdomain == nil || b.Subdomain == nil || c.Subdomain.Url.String() != b.Subdomain.Url.String()) {
 		return false
 	}
@@ -83,7 +114,7 @@ func NewCrawlItem(URL *url.URL) *CrawlItem {
 
 func NewCrawlItemFromString(str *string, subdomains []*Subdomain) *CrawlItem {
 	parts := strings.Split(*str, "	")
-	if len(parts) != 8 {
+	if len(parts) != crawlItemColumns && len(parts) != crawlItemIntervalColumns && len(parts) != crawlItemValidatorColumns && len(parts) != crawlItemOldColumns {
 		fmt.Println("Ongeldig aantal tabs")
 		return nil
 	}
@@ -141,18 +172,45 @@ func NewCrawlItemFromString(str *string, subdomains []*Subdomain) *CrawlItem {
 		ds = &downloadStarted
 	}
 
-	if subdomains == nil {
-		return &CrawlItem{
-			URL:                 u,
-			Depth:               depth,
-			Cycle:               cycle,
-			Ignore:              ignore,
-			FailCount:           failCount,
-			LastDownload:        d,
-			LastDownloadStarted: ds,
+	item := &CrawlItem{
+		URL:                 u,
+		Depth:               depth,
+		Cycle:               cycle,
+		Ignore:              ignore,
+		FailCount:           failCount,
+		LastDownload:        d,
+		LastDownloadStarted: ds,
+	}
+
+	if len(parts) >= crawlItemValidatorColumns {
+		item.ETag = parts[8]
+		item.LastModified = parts[9]
+		item.ContentHash = parts[10]
+		if len(parts[11]) > 0 {
+			item.Links = strings.Split(parts[11], " ")
+		} else if item.ETag != "" || item.LastModified != "" {
+			// Pagina zonder links
+			item.Links = []string{}
 		}
 	}
 
+	if len(parts) >= crawlItemIntervalColumns {
+		seconds, err := strconv.Atoi(parts[12])
+		if err != nil {
+			fmt.Println("ongeldig change interval")
+			return nil
+		}
+		item.ChangeInterval = time.Duration(seconds) * time.Second
+	}
+
+	if len(parts) >= crawlItemColumns {
+		item.QueryVersion = parts[13]
+	}
+
+	if subdomains == nil {
+		return item
+	}
+
 	subdomainIndex, err := strconv.Atoi(parts[7])
 	if err != nil {
 		fmt.Println("ongeldige subdomainIndex")
@@ -164,17 +222,7 @@ func NewCrawlItemFromString(str *string, subdomains []*Subdomain) *CrawlItem {
 		return nil
 	}
 	subdomain := subdomains[subdomainIndex]
-
-	item := &CrawlItem{
-		URL:                 u,
-		Depth:               depth,
-		Cycle:               cycle,
-		Ignore:              ignore,
-		FailCount:           failCount,
-		LastDownload:        d,
-		LastDownloadStarted: ds,
-		Subdomain:           subdomain,
-	}
+	item.Subdomain = subdomain
 
 	subdomain.AlreadyFound[cleanURLPath(u)] = item
 
@@ -244,5 +292,20 @@ func (i *CrawlItem) SaveToString() string {
 	if i.URL.IsAbs() {
 		fmt.Println("CrawlItem url became absolute")
 	}
-	return fmt.Sprintf("%s	%v	%v	%v	%v	%s	%s	%v", i.URL, i.Depth, i.Cycle, i.Ignore, i.FailCount, TimeToString(i.LastDownload), TimeToString(i.LastDownloadStarted), index)
+	return fmt.Sprintf("%s	%v	%v	%v	%v	%s	%s	%v	%s	%s	%s	%s	%v	%s", i.URL, i.Depth, i.Cycle, i.Ignore, i.FailCount, TimeToString(i.LastDownload), TimeToString(i.LastDownloadStarted), index, i.ETag, i.LastModified, i.ContentHash, strings.Join(i.Links, " "), int(i.ChangeInterval/time.Second), i.QueryVersion)
+}
+
+// Of een recrawl met If-None-Match / If-Modified-Since kan gebeuren.
+// Zonder opgeslagen links kunnen we een 304 niet verwerken
+func (i *CrawlItem) CanRevalidate() bool {
+	return i.LastDownload != nil && i.Links != nil && (i.ETag != "" || i.LastModified != "")
+}
+
+// Validators uit een header halen zonder tabs of nieuwe lijnen (die breken SaveToString)
+func cleanValidator(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, "\t\r\n") || len(value) > 256 {
+		return ""
+	}
+	return value
 }
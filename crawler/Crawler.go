@@ -2,6 +2,9 @@ package crawler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/SimonBackx/lantern-crawler/distributors"
 	"github.com/SimonBackx/lantern-crawler/queries"
@@ -25,7 +28,7 @@ type Crawler struct {
 	Workers map[string]*Hostworker
 
 	// DomainCrawlers die klaar staan om wakker gemaakt te worden maar geen requests uitvoeren
-	SleepingCrawlers *WorkerList
+	SleepingCrawlers *WorkerQueue
 
 	// Lijst met workers gerangschikt op basis van wanneer ze
 	// opnieuw gecrawld moeten worden. De workers die als eerste een recrawl
@@ -36,6 +39,14 @@ type Crawler struct {
 	// om één of meerdere items van de RecrawlList te halen
 	RecrawlTimer <-chan time.Time
 
+	// Workers die wachten tot een bepaald tijdstip (bv. Retry-After) en dan
+	// opnieuw aan de SleepingCrawlers toegevoegd moeten worden
+	ParkedWorkers *ParkedQueue
+
+	// Kanaal waarop een bericht zal worden verstuurd als de eerste worker
+	// van ParkedWorkers verder mag
+	WakeTimer <-chan time.Time
+
 	// General update timer
 	UpdateTimer <-chan time.Time
 
@@ -51,6 +62,23 @@ type Crawler struct {
 	Started bool
 	Signal  chan int
 	Queries []queries.Query
+
+	// Hash van Queries, om te weten of een ongewijzigde pagina opnieuw doorzocht moet worden
+	QueryVersion string
+
+	Canonicalizer *Canonicalizer
+
+	// Include/exclude regels uit de configuratie en de API
+	Rules *RuleSet
+
+	// Verplichte blocklist, samengesteld uit het bestand en de API.
+	// Bij een fout blijft de vorige versie van elk deel behouden
+	Blocklist     *Blocklist
+	fileBlocklist *queries.Blocklist
+	apiBlocklist  *queries.Blocklist
+
+	// Gedeelde limiet op de downloadsnelheid
+	Bandwidth *BandwidthLimiter
 }
 
 func NewCrawler(cfg *CrawlerConfig) *Crawler {
@@ -58,7 +86,11 @@ func NewCrawler(cfg *CrawlerConfig) *Crawler {
 
 	var distributor distributors.Distributor
 	if cfg.UseTorProxy {
-		distributor = distributors.NewTor(cfg.TorDaemons, cfg.InitialWorkers, cfg.MaxWorkers, cfg.HeaderTimeout, cfg.RequestTimeout)
+		if len(cfg.TorEndpoints) > 0 {
+			distributor = distributors.NewTorFromEndpoints(cfg.TorEndpoints, cfg.InitialWorkers, cfg.MaxWorkers, cfg.HeaderTimeout, cfg.RequestTimeout, cfg.HealthCheckInterval, cfg.TorBootstrapTimeout, cfg.IsolateHosts, cfg.TorSelection)
+		} else {
+			distributor = distributors.NewTor(cfg.TorDaemons, cfg.InitialWorkers, cfg.MaxWorkers, cfg.HeaderTimeout, cfg.RequestTimeout, cfg.HealthCheckInterval, cfg.TorBootstrapTimeout, cfg.IsolateHosts, cfg.TorSelection)
+		}
 	} else {
 		distributor = distributors.NewClearnet(cfg.InitialWorkers, cfg.MaxWorkers, cfg.HeaderTimeout, cfg.RequestTimeout)
 	}
@@ -70,21 +102,30 @@ func NewCrawler(cfg *CrawlerConfig) *Crawler {
 		cancelContext:      cancelCtx,
 		waitGroup:          wg,
 		Workers:            make(map[string]*Hostworker),
-		SleepingCrawlers:   NewWorkerList(),
+		SleepingCrawlers:   NewWorkerQueue(time.Duration(cfg.PriorityAging) * time.Minute),
 		RecrawlList:        NewWorkerList(),
 		WorkerEnded:        NewWorkerChannel(),
 		WorkerResult:       NewWorkerResultChannel(),
 		WorkerIntroduction: NewWorkerChannel(),
 		speedLogger:        NewSpeedLogger(),
 		Stop:               make(chan struct{}, 1),
+		ParkedWorkers:      NewParkedQueue(),
 		RecrawlTimer:       make(<-chan time.Time, 1),
+		WakeTimer:          make(<-chan time.Time, 1),
 		UpdateTimer:        make(<-chan time.Time, 1),
 		Queries:            make([]queries.Query, 0),
+		QueryVersion:       queryVersion([]queries.Query{}),
 		ApiController:      NewApiController(),
+		Canonicalizer:      NewCanonicalizer(cfg.StripQueryParams),
+		Blocklist:          NewBlocklist(),
+		Bandwidth:          NewBandwidthLimiter(cfg.MaxBandwidth * 1024),
 	}
 	crawler.speedLogger.Crawler = crawler
+	crawler.setRules(nil)
+	crawler.RefreshBlocklist()
 	if !cfg.Testing {
 		crawler.RefreshQueries()
+		crawler.RefreshRules()
 	}
 
 	// Nieuwe queries etc laden
@@ -135,7 +176,7 @@ func NewCrawler(cfg *CrawlerConfig) *Crawler {
 			}
 			crawler.Workers[worker.Host] = worker
 
-			if worker.cachedLastDownload != nil {
+			if worker.cachedNextRecrawl != nil {
 				if cfg.ForceRecrawl {
 					worker.Recrawl()
 				} else {
@@ -180,6 +221,70 @@ func (crawler *Crawler) RefreshQueries() {
 		return
 	}
 	crawler.Queries = queries
+	crawler.QueryVersion = queryVersion(queries)
+}
+
+// Verandert als er een query toegevoegd, aangepast of verwijderd wordt. Een ongewijzigde
+// pagina wordt enkel opnieuw doorzocht als de queries sinds de vorige download veranderden.
+func queryVersion(list []queries.Query) string {
+	data, err := json.Marshal(list)
+	if err != nil {
+		// Onbekend: altijd opnieuw uitvoeren
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (crawler *Crawler) RefreshRules() {
+	rules, err := crawler.ApiController.GetCrawlRules()
+	if err != nil {
+		crawler.cfg.LogError(err)
+		return
+	}
+	crawler.setRules(rules)
+}
+
+func (crawler *Crawler) RefreshBlocklist() {
+	if crawler.cfg.BlocklistFile != "" {
+		list, err := readBlocklistFile(crawler.cfg.BlocklistFile)
+		if err != nil {
+			crawler.cfg.LogError(err)
+		} else {
+			crawler.fileBlocklist = list
+		}
+	}
+
+	if !crawler.cfg.Testing {
+		list, err := crawler.ApiController.GetBlocklist()
+		if err != nil {
+			crawler.cfg.LogError(err)
+		} else {
+			crawler.apiBlocklist = list
+		}
+	}
+
+	errs := crawler.Blocklist.Load(crawler.fileBlocklist, crawler.apiBlocklist)
+	for _, err := range errs {
+		crawler.cfg.LogError(err)
+	}
+
+	if !crawler.Blocklist.Loaded() {
+		crawler.cfg.Log("Warning", "No blocklist loaded (file and API unavailable), not crawling until one loads")
+	}
+}
+
+// Regels uit de configuratie combineren met die van de API
+func (crawler *Crawler) setRules(rules []queries.CrawlRule) {
+	all := make([]queries.CrawlRule, 0, len(crawler.cfg.CrawlRules)+len(rules))
+	all = append(all, crawler.cfg.CrawlRules...)
+	all = append(all, rules...)
+
+	set, errs := NewRuleSet(all)
+	for _, err := range errs {
+		crawler.cfg.LogError(err)
+	}
+	crawler.Rules = set
 }
 
 func (crawler *Crawler) GetDomainForUrl(splitted []string) string {
@@ -191,6 +296,19 @@ func (crawler *Crawler) GetDomainForUrl(splitted []string) string {
 }
 
 func (crawler *Crawler) ProcessUrl(u *url.URL) {
+	crawler.ProcessLink(&FoundLink{Url: u, Type: LinkTypeSeed})
+}
+
+// Verwerkt een link naar een andere host. Nieuwe hosts onthouden hoe ze gevonden werden.
+func (crawler *Crawler) ProcessLink(link *FoundLink) {
+	u := link.Url
+	crawler.Canonicalizer.Canonicalize(u)
+
+	// Geen worker aanmaken voor geblokkeerde hosts, zo komen ze ook niet op disk
+	if crawler.Blocklist.BlocksUrl(u) {
+		return
+	}
+
 	host := crawler.GetDomainForUrl(strings.Split(u.Host, "."))
 	worker := crawler.Workers[host]
 
@@ -200,7 +318,13 @@ func (crawler *Crawler) ProcessUrl(u *url.URL) {
 		}
 
 		worker = NewHostworker(host, crawler)
+		worker.DiscoveredVia = link.Type
+		worker.DiscoveredOn = link.Source
 		crawler.Workers[host] = worker
+
+		if crawler.cfg.LogNetwork && link.Type == LinkTypeMention {
+			crawler.cfg.Log("discovery", host+" mentioned on "+link.Source)
+		}
 	}
 
 	// Crawler queue pushen
@@ -223,8 +347,13 @@ func (crawler *Crawler) ProcessUrl(u *url.URL) {
 }
 
 func (crawler *Crawler) WakeSleepingWorkers() {
-	for crawler.SleepingCrawlers.First != nil {
-		worker := crawler.SleepingCrawlers.First.Worker
+	// De blocklist is verplicht: zonder blocklist geen requests
+	if !crawler.Blocklist.Loaded() {
+		return
+	}
+
+	for !crawler.SleepingCrawlers.IsEmpty() {
+		worker := crawler.SleepingCrawlers.Peek()
 
 		if !worker.WantsToGetUp() {
 			crawler.Panic("Worker " + worker.String() + " heeft lege queue maar staat in sleeping crawlers")
@@ -259,6 +388,51 @@ func (crawler *Crawler) WakeSleepingWorkers() {
 	}
 }
 
+// Zet een worker die niet loopt en nog items heeft in ParkedWorkers als hij
+// pas vanaf een bepaald tijdstip verder mag
+func (crawler *Crawler) ParkWorker(worker *Hostworker) {
+	now := time.Now()
+	until := worker.ParkedUntil(now)
+	if until.IsZero() || until.Equal(worker.parkedUntil) {
+		return
+	}
+
+	next := crawler.ParkedWorkers.Next()
+	worker.parkedUntil = until
+	crawler.ParkedWorkers.Push(worker, until)
+
+	if next == nil || until.Before(*next) {
+		crawler.WakeTimer = time.After(until.Sub(now))
+	}
+}
+
+// Workers uit ParkedWorkers waarvan de wachttijd voorbij is terug aan de SleepingCrawlers toevoegen
+func (crawler *Crawler) CheckParkedWorkers(now time.Time) {
+	for _, worker := range crawler.ParkedWorkers.PopReady(now) {
+		if worker.parkedUntil.After(now) {
+			// Intussen opnieuw geparkeerd tot later
+			continue
+		}
+		worker.parkedUntil = time.Time{}
+
+		if worker.Running || worker.Sleeping {
+			continue
+		}
+
+		if worker.WantsToGetUp() {
+			worker.Sleeping = true
+			crawler.SleepingCrawlers.Push(worker)
+		} else {
+			// Wachttijd werd intussen verlengd
+			crawler.ParkWorker(worker)
+		}
+	}
+
+	if next := crawler.ParkedWorkers.Next(); next != nil {
+		crawler.WakeTimer = time.After(next.Sub(now))
+	}
+}
+
 func (crawler *Crawler) SetRecrawlFirst(worker *Hostworker) {
 	duration := worker.GetRecrawlDuration()
 
@@ -322,6 +496,9 @@ func (crawler *Crawler) CheckRecrawlList(force bool) {
 				// Deze worker had geen items, maar nu wel
 				worker.Sleeping = true
 				crawler.SleepingCrawlers.Push(worker)
+			} else if !worker.Sleeping {
+				// Bv. dagbudget al op: wakker maken als het weer aangevuld is
+				crawler.ParkWorker(worker)
 			}
 		}
 	}
@@ -418,7 +595,8 @@ func (crawler *Crawler) Start(signal chan int) {
 					worker.Sleeping = true
 					crawler.SleepingCrawlers.Push(worker)
 				} else {
-					// todo: toevoegen aan completeFails?
+					// Wakker maken als de Retry-After voorbij is of het dagbudget weer aangevuld is
+					crawler.ParkWorker(worker)
 				}
 
 				// Een worker heeft zich afgesloten
@@ -432,8 +610,8 @@ func (crawler *Crawler) Start(signal chan int) {
 			// Resultaat van een of meerdere workers verwerken
 
 			// 1. URL's
-			for _, url := range result.Links {
-				crawler.ProcessUrl(url)
+			for _, link := range result.Links {
+				crawler.ProcessLink(link)
 			}
 
 			// 2. Andere data (voor later)
@@ -450,6 +628,8 @@ func (crawler *Crawler) Start(signal chan int) {
 
 		case <-crawler.UpdateTimer:
 			crawler.RefreshQueries()
+			crawler.RefreshRules()
+			crawler.RefreshBlocklist()
 			crawler.UpdateTimer = time.After(time.Minute * 5)
 
 			// checken of we niet een te lage load hebben, en anders vroegtijdig een recrawl forceren
@@ -470,6 +650,10 @@ func (crawler *Crawler) Start(signal chan int) {
 
 			crawler.WakeSleepingWorkers()
 
+		case <-crawler.WakeTimer:
+			crawler.CheckParkedWorkers(time.Now())
+			crawler.WakeSleepingWorkers()
+
 		case <-crawler.RecrawlTimer:
 			crawler.CheckRecrawlList(false)
 
@@ -2,6 +2,7 @@ package crawler
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/SimonBackx/lantern-crawler/queries"
 	"golang.org/x/net/html"
 	"io"
@@ -10,10 +11,28 @@ import (
 )
 
 type ParseResult struct {
-	Urls       []*url.URL
+	Links      []*FoundLink
 	Results    []*queries.Result
 	Title      *string
 	Lowercased []byte
+
+	// Charset van het originele document (voor omzetting naar UTF-8)
+	Charset string
+
+	// Geëxtraheerde tekst als de originele data geen tekst is (documenten)
+	Text []byte
+
+	// Zichtbare tekst met originele hoofdletters (voor indicators)
+	Visible []byte
+
+	// Lowercased tekst per pagina (enkel bij documenten)
+	Pages [][]byte
+
+	// <base href> van een HTML document, relatieve links vertrekken hiervan
+	Base *url.URL
+
+	// <link rel="canonical"> van een HTML document
+	Canonical *url.URL
 }
 
 /*func byteArrayToString(b []byte) string {
@@ -21,16 +40,30 @@ type ParseResult struct {
 }*/
 
 // Momenteel nog geen return value, dat is voor later
-func Parse(reader io.Reader, queryList []queries.Query, parseUrls bool) (*ParseResult, error) {
+func Parse(reader io.Reader, handler ContentHandler, queryList []queries.Query, parseUrls bool) (*ParseResult, error) {
 	data, err := ioutil.ReadAll(reader)
 
 	if err != nil {
 		return nil, err
 	}
-	result := ReadHtml(data, parseUrls)
+	result := handler(data, parseUrls)
+
+	// Nieuwe onion adressen worden meestal als tekst gepost
+	if parseUrls {
+		result.Links = append(result.Links, findOnionMentions(result.Lowercased)...)
+	}
+
+	if result.Text != nil {
+		data = result.Text
+	}
 
 	// Queries op uitvoeren
 	source := queries.NewSource(result.Lowercased)
+	pageSources := make([]*queries.Source, len(result.Pages))
+	for i, page := range result.Pages {
+		pageSources[i] = queries.NewSource(page)
+	}
+
 	var dataStr *string
 	for _, query := range queryList {
 		snippet := query.Execute(source)
@@ -39,6 +72,10 @@ func Parse(reader io.Reader, queryList []queries.Query, parseUrls bool) (*ParseR
 				str := string(data)
 				dataStr = &str
 			}
+
+			if pageSnippet := executeOnPages(&query, pageSources); pageSnippet != nil {
+				snippet = pageSnippet
+			}
 			apiResult := queries.NewResult(query, nil, nil, dataStr, result.Title, snippet)
 			result.Results = append(result.Results, apiResult)
 		}
@@ -47,19 +84,35 @@ func Parse(reader io.Reader, queryList []queries.Query, parseUrls bool) (*ParseR
 	return result, nil
 }
 
+// Zoekt de eerste pagina waarop de query gevonden wordt en zet het
+// paginanummer in de snippet. Een query die over meerdere pagina's verspreid
+// staat houdt de snippet van het volledige document.
+func executeOnPages(query *queries.Query, pageSources []*queries.Source) *string {
+	for i, source := range pageSources {
+		snippet := query.Execute(source)
+		if snippet != nil {
+			str := fmt.Sprintf("Page %v: %v", i+1, *snippet)
+			return &str
+		}
+	}
+	return nil
+}
+
 func ReadHtml(data []byte, parseUrls bool) *ParseResult {
 	reader := NewPositionReader(bytes.NewReader(data))
 
 	lowercased := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	visible := bytes.NewBuffer(make([]byte, 0, len(data)/2))
 
 	head_depth := 0
 	title_depth := 0
 	var title string
-	result := &ParseResult{Urls: make([]*url.URL, 0)}
+	result := &ParseResult{Links: make([]*FoundLink, 0)}
 
 	z := html.NewTokenizer(reader)
 
 	ignore_depth := 0
+	script_depth := 0
 
 	for {
 		tt := z.Next()
@@ -68,12 +121,19 @@ func ReadHtml(data []byte, parseUrls bool) *ParseResult {
 		switch tt {
 		case html.ErrorToken:
 			result.Lowercased = lowercased.Bytes()
+			result.Visible = visible.Bytes()
 			return result
 
 		case html.TextToken:
 			if ignore_depth == 0 && head_depth == 0 {
+				// Text() mag maar één keer opgevraagd worden
+				text := z.Text()
+
+				visible.WriteByte(0)
+				visible.Write(text)
+
 				lowercased.WriteByte(0)
-				lowercased.Write(bytes.ToLower(z.Text()))
+				lowercased.Write(bytes.ToLower(text))
 
 				/*endIndex := reader.Position - len(z.Buffered())
 				str := z.Raw()
@@ -86,6 +146,10 @@ func ReadHtml(data []byte, parseUrls bool) *ParseResult {
 				previousEnd = endIndex*/
 			}
 
+			if script_depth > 0 && parseUrls {
+				result.Links = append(result.Links, findScriptLinks(z.Text())...)
+			}
+
 			if title_depth == 1 {
 				// kopie maken
 				title = string(z.Text())
@@ -93,35 +157,36 @@ func ReadHtml(data []byte, parseUrls bool) *ParseResult {
 			}
 
 		// Links detecteren
-		case html.StartTagToken:
-			tn, _ := z.TagName()
-
-			if len(tn) == 1 && tn[0] == 'a' {
-				if parseUrls {
-					key, val, moreAttr := z.TagAttr()
-					for key != nil {
-
-						if string(key) == "href" {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tn, hasAttr := z.TagName()
 
-							attrUrl := ParseUrlFromHref(val)
-							if attrUrl != nil {
-								result.Urls = append(result.Urls, attrUrl)
-							}
-							break
-						}
-
-						if !moreAttr {
-							break
-						}
-						key, val, moreAttr = z.TagAttr()
+			if parseUrls && hasAttr {
+				if string(tn) == "base" {
+					if result.Base == nil {
+						result.Base = ParseUrlFromHref([]byte(readTagAttributes(z)["href"]))
+					}
+				} else if link := readTagLink(string(tn), z); link != nil {
+					if link.Type != LinkTypeCanonical {
+						result.Links = append(result.Links, link)
+					} else if result.Canonical == nil {
+						result.Canonical = link.Url
 					}
 				}
-			} else if string(tn) == "head" {
+			}
+
+			if tt == html.SelfClosingTagToken {
+				break
+			}
+
+			if string(tn) == "head" {
 				head_depth++
 			} else if head_depth > 0 && string(tn) == "title" {
 				title_depth++
 			} else if string(tn) == "script" || string(tn) == "noscript" || string(tn) == "style" {
 				ignore_depth++
+				if string(tn) == "script" {
+					script_depth++
+				}
 			}
 
 		case html.EndTagToken:
@@ -132,6 +197,9 @@ func ReadHtml(data []byte, parseUrls bool) *ParseResult {
 				title_depth--
 			} else if string(tn) == "script" || string(tn) == "noscript" || string(tn) == "style" {
 				ignore_depth--
+				if string(tn) == "script" {
+					script_depth--
+				}
 			}
 
 		}
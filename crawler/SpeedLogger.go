@@ -13,6 +13,10 @@ type SpeedLogger struct {
 	DownloadTime time.Duration
 	Timeouts     int
 
+	// Recrawls die geen nieuwe inhoud opleverden: 304 of dezelfde hash
+	NotModified int
+	Unchanged   int
+
 	Ticker  *time.Ticker
 	Crawler *Crawler
 }
@@ -63,19 +67,46 @@ func (logger *SpeedLogger) Run() {
 			memorySys,
 		))
 
-		// check memory (maximum 7,5Gb)
-		if memoryAlloc > 7000000 {
+		// check memory
+		maxMemory := uint64(logger.Crawler.cfg.MaxMemory)
+		if maxMemory > 0 && memoryAlloc > maxMemory {
 			logger.Crawler.distributor.DecreaseClients()
 		} else {
 			// Als er veel timeouts zijn -> vertragen
 			if logger.Timeouts > logger.Crawler.cfg.MaxTimeouts && logger.Crawler.distributor.AvailableClients() >= 0 {
 				logger.Crawler.distributor.DecreaseClients()
-			} else if logger.Timeouts < logger.Crawler.cfg.MinTimeouts && logger.Crawler.distributor.AvailableClients() == 0 && memoryAlloc < 6200000 {
+			} else if logger.Timeouts < logger.Crawler.cfg.MinTimeouts && logger.Crawler.distributor.AvailableClients() == 0 && (maxMemory == 0 || memoryAlloc < maxMemory/100*88) {
 				logger.Crawler.distributor.IncreaseClients()
 			}
 		}
 
 		stats := queries.NewStats(logger.Count, logger.Timeouts, workers, domains, downloadSpeed, downloadTime, downloadSize, memoryAlloc, memorySys)
+		stats.Clients = logger.Crawler.distributor.CollectClientStats()
+		stats.Blocked = logger.Crawler.Blocklist.CollectStats()
+		stats.NotModified = logger.NotModified
+		stats.Unchanged = logger.Unchanged
+
+		if logger.NotModified > 0 || logger.Unchanged > 0 {
+			logger.Crawler.cfg.Log("Stat", fmt.Sprintf("%v not modified, %v unchanged", logger.NotModified, logger.Unchanged))
+		}
+
+		if stats.Blocked != nil {
+			logger.Crawler.cfg.Log("Blocklist", fmt.Sprintf("blocked %v hosts, %v urls, %v pages", stats.Blocked.Hosts, stats.Blocked.Patterns, stats.Blocked.Content))
+		}
+
+		if logger.Crawler.cfg.LogNetwork {
+			for _, client := range stats.Clients {
+				logger.Crawler.cfg.Log("Stat", fmt.Sprintf("%v: healthy %v, %v workers, %v in flight, %v requests, %v errors, %v ms latency",
+					client.Address,
+					client.Healthy,
+					client.Workers,
+					client.InFlight,
+					client.Requests,
+					client.Errors,
+					client.Latency,
+				))
+			}
+		}
 		logger.Crawler.ApiController.SaveStats(stats)
 
 		logger.Count = 0
@@ -83,6 +114,8 @@ func (logger *SpeedLogger) Run() {
 		logger.DownloadTime = 0
 
 		logger.Timeouts = 0
+		logger.NotModified = 0
+		logger.Unchanged = 0
 
 	}
 }
@@ -96,3 +129,11 @@ func (logger *SpeedLogger) Log(duration time.Duration, bytes int) {
 func (logger *SpeedLogger) LogTimeout() {
 	logger.Timeouts++
 }
+
+func (logger *SpeedLogger) LogNotModified() {
+	logger.NotModified++
+}
+
+func (logger *SpeedLogger) LogUnchanged() {
+	logger.Unchanged++
+}
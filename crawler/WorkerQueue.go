@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Worker in de WorkerQueue. Hoe hoger de score, hoe verder de worker
+// naar voor geschoven wordt ten opzichte van het moment waarop hij toegevoegd werd.
+type queuedWorker struct {
+	Worker *Hostworker
+	key    time.Time
+	seq    int
+}
+
+type workerHeap []*queuedWorker
+
+func (h workerHeap) Len() int { return len(h) }
+
+func (h workerHeap) Less(i, j int) bool {
+	if h[i].key.Equal(h[j].key) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].key.Before(h[j].key)
+}
+
+func (h workerHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *workerHeap) Push(x interface{}) {
+	*h = append(*h, x.(*queuedWorker))
+}
+
+func (h *workerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// Prioriteitswachtrij voor workers die wakker gemaakt willen worden. Een worker krijgt
+// aging minuten voorsprong per punt score. Omdat die voorsprong begrensd is, komt
+// elke worker uiteindelijk vooraan (geen starvation). Met aging 0 is de volgorde FIFO.
+type WorkerQueue struct {
+	heap  workerHeap
+	aging time.Duration
+	seq   int
+}
+
+func NewWorkerQueue(aging time.Duration) *WorkerQueue {
+	return &WorkerQueue{heap: make(workerHeap, 0), aging: aging}
+}
+
+func (queue *WorkerQueue) IsEmpty() bool {
+	return len(queue.heap) == 0
+}
+
+func (queue *WorkerQueue) Length() int {
+	return len(queue.heap)
+}
+
+func (queue *WorkerQueue) Push(worker *Hostworker) {
+	queue.PushWithScore(worker, worker.Priority(), time.Now())
+}
+
+func (queue *WorkerQueue) PushWithScore(worker *Hostworker, score float64, now time.Time) {
+	queue.seq++
+	key := now.Add(-time.Duration(score * float64(queue.aging)))
+	heap.Push(&queue.heap, &queuedWorker{Worker: worker, key: key, seq: queue.seq})
+}
+
+// Volgende worker zonder die te verwijderen
+func (queue *WorkerQueue) Peek() *Hostworker {
+	if len(queue.heap) == 0 {
+		return nil
+	}
+	return queue.heap[0].Worker
+}
+
+func (queue *WorkerQueue) Pop() *Hostworker {
+	if len(queue.heap) == 0 {
+		return nil
+	}
+	return heap.Pop(&queue.heap).(*queuedWorker).Worker
+}
+
+// Workers met items die pas vanaf een bepaald tijdstip verder mogen (bv. Retry-After),
+// gerangschikt op dat tijdstip
+type ParkedQueue struct {
+	heap workerHeap
+	seq  int
+}
+
+func NewParkedQueue() *ParkedQueue {
+	return &ParkedQueue{heap: make(workerHeap, 0)}
+}
+
+func (queue *ParkedQueue) Length() int {
+	return len(queue.heap)
+}
+
+func (queue *ParkedQueue) Push(worker *Hostworker, until time.Time) {
+	queue.seq++
+	heap.Push(&queue.heap, &queuedWorker{Worker: worker, key: until, seq: queue.seq})
+}
+
+// Vroegste tijdstip in de queue, nil als de queue leeg is
+func (queue *ParkedQueue) Next() *time.Time {
+	if len(queue.heap) == 0 {
+		return nil
+	}
+	next := queue.heap[0].key
+	return &next
+}
+
+// Haalt alle workers uit de queue waarvan het tijdstip voorbij is
+func (queue *ParkedQueue) PopReady(now time.Time) []*Hostworker {
+	result := make([]*Hostworker, 0)
+	for len(queue.heap) > 0 && !queue.heap[0].key.After(now) {
+		result = append(result, heap.Pop(&queue.heap).(*queuedWorker).Worker)
+	}
+	return result
+}
@@ -1,21 +1,17 @@
 package crawler
 
-import (
-	"net/url"
-)
-
 type WorkerResult struct {
-	Links []*url.URL
+	Links []*FoundLink
 }
 
 func NewWorkerResult() *WorkerResult {
 	return &WorkerResult{
-		Links: make([]*url.URL, 0, 5),
+		Links: make([]*FoundLink, 0, 5),
 	}
 }
 
-func (r *WorkerResult) Append(url *url.URL) {
-	r.Links = append(r.Links, url)
+func (r *WorkerResult) Append(link *FoundLink) {
+	r.Links = append(r.Links, link)
 }
 
 // The pop channel is a stacked channel used by workers to pop the next URL(s)
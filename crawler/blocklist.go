@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Verplichte lijst van hosts, url patronen en inhoud die nooit gedownload of
+// opgeslagen mogen worden. Wordt vanuit alle workers tegelijk gebruikt.
+type Blocklist struct {
+	// Tellers sinds de vorige CollectStats (sync/atomic, vooraan voor 64-bit alignment)
+	hostsBlocked    int64
+	patternsBlocked int64
+	contentBlocked  int64
+
+	lock     sync.RWMutex
+	hosts    map[string]bool
+	patterns []*regexp.Regexp
+	content  map[string]bool
+
+	// Minstens één bron (bestand of API) werd ingelezen
+	loaded bool
+}
+
+func NewBlocklist() *Blocklist {
+	return &Blocklist{hosts: make(map[string]bool), content: make(map[string]bool)}
+}
+
+// Zonder ingelezen blocklist mag er niet gecrawld worden
+func (b *Blocklist) Loaded() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.loaded
+}
+
+// Hash waaronder een host in de blocklist staat
+func HashHost(host string) string {
+	host = strings.ToLower(host)
+	if index := strings.LastIndex(host, ":"); index != -1 {
+		host = host[:index]
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	sum := sha256.Sum256([]byte(host))
+	return hex.EncodeToString(sum[:])
+}
+
+// Vervangt de volledige blocklist door de samenvoeging van lists. Ongeldige
+// hashes en regexps worden overgeslagen en teruggegeven als fout
+func (b *Blocklist) Load(lists ...*queries.Blocklist) []error {
+	hosts := make(map[string]bool)
+	content := make(map[string]bool)
+	patterns := make([]*regexp.Regexp, 0)
+	errs := make([]error, 0)
+
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+
+		errs = addBlocklistHashes(hosts, list.Hosts, errs)
+		errs = addBlocklistHashes(content, list.Content, errs)
+
+		for _, pattern := range list.Patterns {
+			reg, err := regexp.Compile(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Invalid blocklist pattern %q: %v", pattern, err))
+				continue
+			}
+			patterns = append(patterns, reg)
+		}
+	}
+
+	b.lock.Lock()
+	b.hosts = hosts
+	b.patterns = patterns
+	b.content = content
+	for _, list := range lists {
+		if list != nil {
+			b.loaded = true
+		}
+	}
+	b.lock.Unlock()
+
+	return errs
+}
+
+func addBlocklistHashes(set map[string]bool, hashes []string, errs []error) []error {
+	for _, hash := range hashes {
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			errs = append(errs, fmt.Errorf("Invalid blocklist hash %q", hash))
+			continue
+		}
+		set[hash] = true
+	}
+	return errs
+}
+
+// Een host is ook geblokkeerd als één van zijn bovenliggende domeinen op de lijst staat
+func (b *Blocklist) blocksHost(host string) bool {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		if b.hosts[HashHost(strings.Join(labels[i:], "."))] {
+			return true
+		}
+	}
+	return false
+}
+
+// Geeft true terug als de (absolute) url niet gedownload mag worden
+func (b *Blocklist) BlocksUrl(u *url.URL) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if len(b.hosts) > 0 && b.blocksHost(u.Hostname()) {
+		atomic.AddInt64(&b.hostsBlocked, 1)
+		return true
+	}
+
+	if len(b.patterns) > 0 {
+		str := u.String()
+		for _, reg := range b.patterns {
+			if reg.MatchString(str) {
+				atomic.AddInt64(&b.patternsBlocked, 1)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Of er hashes van inhoud zijn, anders moeten we niets hashen
+func (b *Blocklist) HasContent() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.content) > 0
+}
+
+// Geeft true terug als de SHA-256 hash van een gedownload bestand op de lijst staat
+func (b *Blocklist) BlocksContent(sum []byte) bool {
+	b.lock.RLock()
+	blocked := b.content[hex.EncodeToString(sum)]
+	b.lock.RUnlock()
+
+	if blocked {
+		atomic.AddInt64(&b.contentBlocked, 1)
+	}
+	return blocked
+}
+
+// Tellers sinds de vorige oproep, nil als er niets geweigerd werd
+func (b *Blocklist) CollectStats() *queries.BlocklistStats {
+	stats := &queries.BlocklistStats{
+		Hosts:    int(atomic.SwapInt64(&b.hostsBlocked, 0)),
+		Patterns: int(atomic.SwapInt64(&b.patternsBlocked, 0)),
+		Content:  int(atomic.SwapInt64(&b.contentBlocked, 0)),
+	}
+	if stats.Hosts == 0 && stats.Patterns == 0 && stats.Content == 0 {
+		return nil
+	}
+	return stats
+}
+
+func readBlocklistFile(path string) (*queries.Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &queries.Blocklist{}
+	err = json.NewDecoder(file).Decode(list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
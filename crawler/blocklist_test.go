@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestBlocklist(test *testing.T) {
+	content := sha256.Sum256([]byte("blocked page"))
+
+	blocklist := NewBlocklist()
+	errs := blocklist.Load(&queries.Blocklist{
+		Hosts:    []string{HashHost("blocked.onion"), "not-a-hash"},
+		Patterns: []string{"/forbidden/"},
+	}, &queries.Blocklist{
+		Content: []string{hex.EncodeToString(content[:])},
+	})
+
+	if len(errs) != 1 {
+		test.Logf("Expected one invalid hash, got %v", errs)
+		test.Fail()
+	}
+
+	tests := map[string]bool{
+		"http://blocked.onion/":             true,
+		"http://sub.blocked.onion:80/page":  true,
+		"http://BLOCKED.onion./":            true,
+		"http://notblocked.onion/":          false,
+		"http://other.onion/forbidden/page": true,
+		"http://other.onion/allowed/page":   false,
+	}
+
+	for str, expected := range tests {
+		u, _ := url.Parse(str)
+		if blocklist.BlocksUrl(u) != expected {
+			test.Logf("BlocksUrl(%v) should be %v", str, expected)
+			test.Fail()
+		}
+	}
+
+	if !blocklist.HasContent() || !blocklist.BlocksContent(content[:]) {
+		test.Log("Blocked content not detected")
+		test.Fail()
+	}
+
+	other := sha256.Sum256([]byte("other page"))
+	if blocklist.BlocksContent(other[:]) {
+		test.Log("Content blocked without hash on the list")
+		test.Fail()
+	}
+
+	stats := blocklist.CollectStats()
+	if stats == nil || stats.Hosts != 3 || stats.Patterns != 1 || stats.Content != 1 {
+		test.Logf("Wrong blocklist stats %+v", stats)
+		test.Fail()
+	}
+
+	if blocklist.CollectStats() != nil {
+		test.Log("Stats not reset")
+		test.Fail()
+	}
+}
+
+func TestBlockedRedirect(test *testing.T) {
+	blocklist := NewBlocklist()
+	blocklist.Load(&queries.Blocklist{Patterns: []string{"/blocked$"}})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			test.Log("Blocked url was fetched")
+			test.Fail()
+		}
+		http.Redirect(w, r, "/blocked", http.StatusFound)
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request = request.WithContext(distributors.WithRedirectFilter(request.Context(), func(u *url.URL) bool {
+		return !blocklist.BlocksUrl(u)
+	}))
+
+	client := &http.Client{CheckRedirect: distributors.CheckRedirect}
+	response, err := client.Do(request)
+	if err == nil {
+		response.Body.Close()
+	}
+
+	if kind := ClassifyNetworkError(err); kind != NetworkErrorRedirectBlocked {
+		test.Logf("Blocked redirect classified as %v", kind)
+		test.Fail()
+	}
+}
+
+func TestBlocklistRequired(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, BlocklistFile: "/nonexistent/blocklist.json"})
+	if crawler.Blocklist.Loaded() {
+		test.Log("Missing blocklist file reported as loaded")
+		test.Fail()
+	}
+
+	worker := NewHostworker("test.com", crawler)
+	u, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(u, nil, false)
+	worker.Sleeping = true
+	crawler.SleepingCrawlers.Push(worker)
+
+	crawler.WakeSleepingWorkers()
+	if worker.Running || crawler.SleepingCrawlers.Length() != 1 {
+		test.Log("Worker started without a blocklist")
+		test.Fail()
+	}
+
+	// Een lege lijst van de API volstaat
+	crawler.Blocklist.Load(nil, &queries.Blocklist{})
+	if !crawler.Blocklist.Loaded() {
+		test.Log("Blocklist not loaded")
+		test.Fail()
+	}
+}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"strings"
+	"time"
+)
+
+// Verbruik van een host in de huidige recrawl cycle en de huidige dag (UTC).
+// Enkel aanpassen vanuit de worker, de crawler leest Exhausted als de worker niet loopt.
+type CrawlBudget struct {
+	Cycle      int
+	CyclePages int
+	CycleBytes int64
+	CycleTime  time.Duration
+
+	Day      time.Time
+	DayPages int
+	DayBytes int64
+	DayTime  time.Duration
+
+	// Begin van de huidige Run van de worker (nul als die niet loopt)
+	running time.Time
+
+	// Reden waarom het budget op is, om maar één keer te loggen
+	exhausted string
+}
+
+// Zet de tellers terug op nul bij een nieuwe cycle of een nieuwe dag
+func (b *CrawlBudget) update(now time.Time, cycle int) {
+	if b.Cycle != cycle {
+		b.Cycle = cycle
+		b.CyclePages = 0
+		b.CycleBytes = 0
+		b.CycleTime = 0
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !b.Day.Equal(day) {
+		b.Day = day
+		b.DayPages = 0
+		b.DayBytes = 0
+		b.DayTime = 0
+	}
+}
+
+func (b *CrawlBudget) AddPage(now time.Time, cycle int) {
+	b.update(now, cycle)
+	b.CyclePages++
+	b.DayPages++
+}
+
+func (b *CrawlBudget) AddBytes(n int, now time.Time, cycle int) {
+	b.update(now, cycle)
+	b.CycleBytes += int64(n)
+	b.DayBytes += int64(n)
+}
+
+func (b *CrawlBudget) Start(now time.Time) {
+	b.running = now
+}
+
+func (b *CrawlBudget) Stop(now time.Time, cycle int) {
+	if b.running.IsZero() {
+		return
+	}
+	elapsed := now.Sub(b.running)
+	b.running = time.Time{}
+
+	b.update(now, cycle)
+	b.CycleTime += elapsed
+	b.DayTime += elapsed
+}
+
+// Geeft terug welk budget op is, of een lege string als de host verder mag
+func (b *CrawlBudget) Exhausted(cfg *CrawlerConfig, now time.Time, cycle int) string {
+	b.update(now, cycle)
+
+	var running time.Duration
+	if !b.running.IsZero() {
+		running = now.Sub(b.running)
+	}
+
+	switch {
+	case cfg.CycleMaxPages > 0 && b.CyclePages >= cfg.CycleMaxPages:
+		return "cycle pages"
+	case cfg.CycleMaxBytes > 0 && b.CycleBytes >= int64(cfg.CycleMaxBytes)*1024:
+		return "cycle bytes"
+	case cfg.CycleMaxTime > 0 && b.CycleTime+running >= time.Duration(cfg.CycleMaxTime)*time.Minute:
+		return "cycle time"
+	case cfg.DayMaxPages > 0 && b.DayPages >= cfg.DayMaxPages:
+		return "day pages"
+	case cfg.DayMaxBytes > 0 && b.DayBytes >= int64(cfg.DayMaxBytes)*1024:
+		return "day bytes"
+	case cfg.DayMaxTime > 0 && b.DayTime+running >= time.Duration(cfg.DayMaxTime)*time.Minute:
+		return "day time"
+	}
+	return ""
+}
+
+// Tijdstip waarop een opgebruikt dagbudget weer aangevuld wordt, nul als het dagbudget
+// niet de reden is. Een cycle budget wacht op de volgende recrawl
+func (b *CrawlBudget) DayResetsAt() time.Time {
+	if !strings.HasPrefix(b.exhausted, "day") {
+		return time.Time{}
+	}
+	return b.Day.Add(24 * time.Hour)
+}
+
+func (b *CrawlBudget) Stats() *queries.BudgetStats {
+	return &queries.BudgetStats{
+		CyclePages: b.CyclePages,
+		CycleBytes: b.CycleBytes,
+		CycleTime:  int(b.CycleTime / time.Second),
+		DayPages:   b.DayPages,
+		DayBytes:   b.DayBytes,
+		DayTime:    int(b.DayTime / time.Second),
+		Exhausted:  b.exhausted,
+	}
+}
+
+// Of de host zijn budget voor deze cycle of vandaag opgebruikt heeft. Logt één keer per keer
+// dat het budget op raakt, de worker blijft dan geparkeerd tot de volgende cycle of dag
+func (w *Hostworker) BudgetExhausted() bool {
+	// Een recrawl die wacht tot de worker in memory komt, start al een nieuwe cycle
+	cycle := w.LatestCycle
+	if w.cachedRecrawlOnMemory {
+		cycle++
+	}
+
+	reason := w.Budget.Exhausted(w.crawler.cfg, time.Now(), cycle)
+	if reason != "" && reason != w.Budget.exhausted {
+		w.crawler.cfg.Log("budget", fmt.Sprintf("%v reached %v budget (cycle %v: %v pages, %v KB)", w.String(), reason, w.LatestCycle, w.Budget.CyclePages, w.Budget.CycleBytes/1024))
+	}
+	w.Budget.exhausted = reason
+	return reason != ""
+}
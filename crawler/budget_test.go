@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlBudget(test *testing.T) {
+	cfg := &CrawlerConfig{CycleMaxPages: 3, CycleMaxTime: 5, DayMaxBytes: 10}
+	budget := &CrawlBudget{}
+	now := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if reason := budget.Exhausted(cfg, now, 1); reason != "" {
+			test.Logf("Budget exhausted too early: %v", reason)
+			test.Fail()
+		}
+		budget.AddPage(now, 1)
+	}
+	if budget.Exhausted(cfg, now, 1) != "cycle pages" {
+		test.Log("Page budget not enforced")
+		test.Fail()
+	}
+
+	// Nieuwe cycle: pagina's terug op nul, bytes van vandaag blijven
+	budget.AddBytes(10*1024, now, 2)
+	if budget.CyclePages != 0 || budget.Exhausted(cfg, now, 2) != "day bytes" {
+		test.Logf("Wrong budget in new cycle: %v pages", budget.CyclePages)
+		test.Fail()
+	}
+
+	tomorrow := now.Add(24 * time.Hour)
+	if reason := budget.Exhausted(cfg, tomorrow, 2); reason != "" || budget.DayBytes != 0 {
+		test.Logf("Day budget not reset: %v", reason)
+		test.Fail()
+	}
+
+	// Looptijd van de worker telt mee terwijl die loopt
+	budget.Start(tomorrow)
+	if budget.Exhausted(cfg, tomorrow.Add(6*time.Minute), 2) != "cycle time" {
+		test.Log("Time budget not enforced while running")
+		test.Fail()
+	}
+	budget.Stop(tomorrow.Add(6*time.Minute), 2)
+	if budget.CycleTime != 6*time.Minute || budget.DayTime != 6*time.Minute {
+		test.Logf("Wrong time after stop: %v", budget.CycleTime)
+		test.Fail()
+	}
+}
+
+func TestWorkerBudget(test *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<p>page</p>")
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, CycleMaxPages: 2})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+
+	for _, path := range []string{"/", "/a", "/b", "/c"} {
+		u, _ := url.Parse(server.URL + path)
+		worker.NewReference(u, nil, false)
+	}
+
+	// Een item dat nooit verstuurd wordt, telt niet mee
+	item := worker.GetNextRequest()
+	worker.RequestStarted(item)
+	worker.RequestIgnored(item)
+	if worker.Budget.CyclePages != 0 {
+		test.Log("Page counted before the request was sent")
+		test.Fail()
+	}
+
+	for i := 0; i < 2; i++ {
+		item := worker.GetNextRequest()
+		worker.lock.Lock()
+		worker.RequestStarted(item)
+		worker.Request(item)
+		worker.lock.Unlock()
+	}
+
+	if worker.WantsToGetUp() {
+		test.Log("Worker without budget should not want to get up")
+		test.Fail()
+	}
+	if stats := worker.Budget.Stats(); stats.CyclePages != 2 || stats.CycleBytes == 0 || stats.Exhausted != "cycle pages" {
+		test.Logf("Wrong budget stats %+v", stats)
+		test.Fail()
+	}
+
+	// Volgende cycle: weer budget
+	worker.Recrawl()
+	if !worker.WantsToGetUp() {
+		test.Log("Worker should get up in the next cycle")
+		test.Fail()
+	}
+}
+
+func TestBudgetWakeUp(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, DayMaxPages: 2})
+	worker := NewHostworker("test.com", crawler)
+	u, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(u, nil, false)
+
+	now := time.Now()
+	worker.Budget.AddPage(now, worker.LatestCycle)
+	worker.Budget.AddPage(now, worker.LatestCycle)
+	if worker.WantsToGetUp() {
+		test.Log("Worker wants to get up with exhausted day budget")
+		test.Fail()
+	}
+
+	// Wakker maken bij het begin van de volgende dag
+	expected := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	if until := worker.ParkedUntil(now); !until.Equal(expected) {
+		test.Logf("Parked until %v, expected %v", until, expected)
+		test.Fail()
+	}
+
+	crawler.ParkWorker(worker)
+	crawler.CheckParkedWorkers(expected.Add(-time.Second))
+	if crawler.ParkedWorkers.Length() != 1 || worker.Sleeping {
+		test.Log("Worker woken before the next day")
+		test.Fail()
+	}
+
+	// Een cycle budget wacht op de volgende recrawl
+	cycle := NewCrawler(&CrawlerConfig{Testing: true, CycleMaxPages: 1})
+	worker = NewHostworker("test.com", cycle)
+	worker.NewReference(u, nil, false)
+	worker.Budget.AddPage(now, worker.LatestCycle)
+	if !worker.ParkedUntil(now).IsZero() {
+		test.Log("Worker with exhausted cycle budget parked until a time")
+		test.Fail()
+	}
+}
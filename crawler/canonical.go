@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Query parameters die standaard verwijderd worden. Een * op het einde
+// betekent dat alle parameters met dat prefix verwijderd worden.
+var defaultStripQueryParams = []string{
+	"utm_*",
+	"phpsessid",
+	"jsessionid",
+	"aspsessionid*",
+	"sessionid",
+	"session_id",
+	"sid",
+	"fbclid",
+	"gclid",
+}
+
+// Zet url's om naar één vaste schrijfwijze zodat dezelfde pagina
+// niet onder verschillende url's gecrawld wordt
+type Canonicalizer struct {
+	stripParams   map[string]bool
+	stripPrefixes []string
+}
+
+func NewCanonicalizer(stripParams []string) *Canonicalizer {
+	c := &Canonicalizer{stripParams: make(map[string]bool)}
+	for _, param := range stripParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if len(param) == 0 {
+			continue
+		}
+
+		if strings.HasSuffix(param, "*") {
+			c.stripPrefixes = append(c.stripPrefixes, param[:len(param)-1])
+		} else {
+			c.stripParams[param] = true
+		}
+	}
+	return c
+}
+
+func (c *Canonicalizer) strip(name string) bool {
+	name = strings.ToLower(name)
+	if c.stripParams[name] {
+		return true
+	}
+
+	for _, prefix := range c.stripPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Past een absolute url aan:
+//  - scheme en host in kleine letters, zonder standaard poort
+//  - geen fragment
+//  - . en .. segmenten uit het pad verwijderd
+//  - percent-encoding genormaliseerd (hoofdletters, niet-gereserveerde tekens gedecodeerd)
+//  - query parameters gesorteerd, sessie- en tracking parameters verwijderd
+func (c *Canonicalizer) Canonicalize(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = canonicalHost(u.Scheme, u.Host)
+	u.Fragment = ""
+
+	path := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	path = c.stripPathParams(path)
+
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		u.Path = unescaped
+		u.RawPath = path
+		if u.EscapedPath() != path {
+			// Standaard encoding is voldoende
+			u.RawPath = ""
+		}
+	}
+
+	u.RawQuery = c.canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+}
+
+func canonicalHost(scheme, host string) string {
+	host = strings.ToLower(host)
+
+	if scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	} else if scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	}
+
+	// example.com. is dezelfde host als example.com
+	return strings.TrimSuffix(host, ".")
+}
+
+// Verwijdert ;jsessionid=... en gelijkaardige parameters uit padsegmenten
+func (c *Canonicalizer) stripPathParams(path string) string {
+	if !strings.Contains(path, ";") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		index := strings.Index(segment, ";")
+		if index == -1 {
+			continue
+		}
+
+		params := strings.Split(segment[index+1:], ";")
+		kept := []string{segment[:index]}
+		for _, param := range params {
+			name := param
+			if eq := strings.Index(param, "="); eq != -1 {
+				name = param[:eq]
+			}
+
+			if !c.strip(name) {
+				kept = append(kept, param)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+	return strings.Join(segments, "/")
+}
+
+type queryParam struct {
+	name  string
+	value string
+	raw   string
+}
+
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if len(rawQuery) == 0 {
+		return ""
+	}
+
+	// Enkel & als scheiding: sommige servers gebruiken ; in een waarde, dus laten we
+	// die in de url die we opvragen staan (zie queryKey voor het vergelijken)
+	params := make([]queryParam, 0, 4)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if len(raw) == 0 {
+			continue
+		}
+		raw = normalizePercentEncoding(raw)
+
+		name := raw
+		value := ""
+		if eq := strings.Index(raw, "="); eq != -1 {
+			name = raw[:eq]
+			value = raw[eq+1:]
+		}
+
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+
+		if c.strip(name) && !strings.Contains(raw, ";") {
+			continue
+		}
+
+		params = append(params, queryParam{name: name, value: value, raw: raw})
+	}
+
+	// Stabiel sorteren: volgorde van herhaalde parameters kan belangrijk zijn
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].name < params[j].name
+	})
+
+	parts := make([]string, len(params))
+	for i, param := range params {
+		parts[i] = param.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func isUnreserved(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// Decodeert niet-gereserveerde tekens (%7E -> ~) en zet andere escapes in hoofdletters (%2f -> %2F)
+func normalizePercentEncoding(str string) string {
+	if !strings.Contains(str, "%") {
+		return str
+	}
+
+	result := make([]byte, 0, len(str))
+	for i := 0; i < len(str); i++ {
+		if str[i] != '%' || i+2 >= len(str) {
+			result = append(result, str[i])
+			continue
+		}
+
+		high, ok1 := unhex(str[i+1])
+		low, ok2 := unhex(str[i+2])
+		if !ok1 || !ok2 {
+			result = append(result, str[i])
+			continue
+		}
+
+		decoded := high<<4 | low
+		if isUnreserved(decoded) {
+			result = append(result, decoded)
+		} else {
+			result = append(result, '%', strings.ToUpper(str[i+1 : i+2])[0], strings.ToUpper(str[i+2 : i+3])[0])
+		}
+		i += 2
+	}
+	return string(result)
+}
+
+// Remove dot segments uit RFC 3986 (5.2.4)
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// Het eerste (lege) segment van een absoluut pad blijft staan
+			if len(output) > 1 || (len(output) == 1 && output[0] != "") {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	return strings.Join(output, "/")
+}
+
+// Sleutel van een query om dubbele url's te herkennen: ; telt hier ook als scheiding
+// tussen parameters, zodat ?a=1;b=2 en ?b=2&a=1 dezelfde pagina zijn. De url die we
+// opvragen blijft ongewijzigd.
+func queryKey(rawQuery string) string {
+	params := strings.FieldsFunc(rawQuery, func(r rune) bool { return r == '&' || r == ';' })
+	sort.SliceStable(params, func(i, j int) bool {
+		return queryParamName(params[i]) < queryParamName(params[j])
+	})
+	return strings.Join(params, "&")
+}
+
+func queryParamName(raw string) string {
+	if eq := strings.Index(raw, "="); eq != -1 {
+		return raw[:eq]
+	}
+	return raw
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(test *testing.T) {
+	canonicalizer := NewCanonicalizer(defaultStripQueryParams)
+
+	corpus := []struct {
+		input    string
+		expected string
+	}{
+		// Scheme, host en poort
+		{"HTTP://Example.ONION/page", "http://example.onion/page"},
+		{"http://example.onion:80/page", "http://example.onion/page"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"http://example.com:8080/", "http://example.com:8080/"},
+		{"https://example.com:80/", "https://example.com:80/"},
+		{"http://example.com./a", "http://example.com/a"},
+
+		// Fragmenten
+		{"http://example.com/page#section", "http://example.com/page"},
+
+		// Dot segmenten
+		{"http://example.com/a/b/../c", "http://example.com/a/c"},
+		{"http://example.com/a/./b/./c", "http://example.com/a/b/c"},
+		{"http://example.com/../../a", "http://example.com/a"},
+		{"http://example.com/a/b/..", "http://example.com/a/"},
+		{"http://example.com/a/.", "http://example.com/a/"},
+		{"http://example.com/a/.../b", "http://example.com/a/.../b"},
+		{"http://example.com/a/%2E%2E/b", "http://example.com/b"},
+
+		// Percent-encoding
+		{"http://example.com/%7Euser/%61bc", "http://example.com/~user/abc"},
+		{"http://example.com/a%2fb", "http://example.com/a%2Fb"},
+		{"http://example.com/caf%c3%a9", "http://example.com/caf%C3%A9"},
+		{"http://example.com/a%20b", "http://example.com/a%20b"},
+		{"http://example.com/?q=%7e%2f", "http://example.com/?q=~%2F"},
+
+		// Query parameters
+		{"http://example.com/?b=2&a=1", "http://example.com/?a=1&b=2"},
+		{"http://example.com/?a=2&b=1&a=1", "http://example.com/?a=2&a=1&b=1"},
+		{"http://example.com/?PHPSESSID=abc&page=2", "http://example.com/?page=2"},
+		{"http://example.com/?utm_source=x&utm_medium=y&id=5", "http://example.com/?id=5"},
+		{"http://example.com/?sid=1", "http://example.com/"},
+		{"http://example.com/page?", "http://example.com/page"},
+		{"http://example.com/?b=2;a=1", "http://example.com/?b=2;a=1"},
+		{"http://example.com/?c=3&b=2;a=1", "http://example.com/?b=2;a=1&c=3"},
+		{"http://example.com/?ASPSESSIONIDQQGGQ=x&z", "http://example.com/?z"},
+
+		// Sessie in het pad
+		{"http://example.com/shop;jsessionid=ABC123?item=1", "http://example.com/shop?item=1"},
+		{"http://example.com/a;type=b/c", "http://example.com/a;type=b/c"},
+	}
+
+	for _, c := range corpus {
+		u, err := url.Parse(c.input)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		canonicalizer.Canonicalize(u)
+		if u.String() != c.expected {
+			test.Logf("%v canonicalized as %v, expected %v", c.input, u.String(), c.expected)
+			test.Fail()
+		}
+
+		// Nog een keer toepassen mag niets veranderen
+		again := u.String()
+		canonicalizer.Canonicalize(u)
+		if u.String() != again {
+			test.Logf("Canonicalize not idempotent for %v: %v", again, u.String())
+			test.Fail()
+		}
+	}
+}
+
+func TestCanonicalDuplicates(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, StripQueryParams: []string{"sid"}})
+	worker := NewHostworker("test.com", crawler)
+
+	spellings := []string{
+		"http://www.test.com/a/b?x=1&y=2",
+		"http://WWW.test.com:80/a/./b?y=2&x=1",
+		"http://www.test.com/a/c/../b?x=1&y=2&sid=123#top",
+		"http://www.test.com/a/%62?x=1&y=2",
+		"http://www.test.com/a/b?y=2;x=1",
+	}
+
+	var first *CrawlItem
+	for _, spelling := range spellings {
+		u, _ := url.Parse(spelling)
+		item, _ := worker.NewReference(u, nil, false)
+		if item == nil {
+			test.Logf("%v not added", spelling)
+			test.Fail()
+			continue
+		}
+		if first == nil {
+			first = item
+		} else if item != first {
+			test.Logf("%v created a duplicate item", spelling)
+			test.Fail()
+		}
+	}
+
+	// De opgevraagde url behoudt de ; van de pagina
+	if first != nil && first.URL.RawQuery != "x=1&y=2" {
+		test.Logf("Requested query changed to %v", first.URL.RawQuery)
+		test.Fail()
+	}
+
+	// Canonieke url wordt een alias van het bestaande item
+	canonical, _ := url.Parse("http://www.test.com/canonical-page")
+	worker.AddCanonicalAlias(first, canonical)
+
+	u, _ := url.Parse("http://www.test.com/canonical-page/")
+	if item, _ := worker.NewReference(u, nil, false); item != first {
+		test.Log("Link to canonical url did not resolve to the aliased item")
+		test.Fail()
+	}
+
+	// Andere subdomeinen worden niet gealiast
+	other, _ := url.Parse("http://other.test.com/x")
+	worker.AddCanonicalAlias(first, other)
+	if len(first.Subdomain.Aliases) != 1 {
+		test.Log("Canonical url on other subdomain should be ignored")
+		test.Fail()
+	}
+}
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Aantal bytes dat we inlezen om content type en charset te bepalen.
+// Meta charset tags moeten volgens de HTML spec in de eerste 1024 bytes staan
+const sniffLength = 1024
+
+// Bepaalt of de response een HTML document is. DetectContentType herkent
+// HTML niet als het document begint met een BOM of XML prolog, dan vertrouwen we de header.
+func isHtmlResponse(firstBytes []byte, contentType string) bool {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(firstBytes))
+	if sniffed == "text/html" {
+		return true
+	}
+
+	header, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if header != "text/html" && header != "application/xhtml+xml" {
+		return false
+	}
+	return sniffed == "text/plain" || sniffed == "text/xml"
+}
+
+// Bepaalt de charset op basis van BOM, de Content-Type header, meta tags en
+// als laatste redmiddel het sniffen van de inhoud (utf-8 of windows-1252).
+func detectCharset(firstBytes []byte, contentType string) (encoding.Encoding, string) {
+	e, name, _ := charset.DetermineEncoding(firstBytes, contentType)
+	return e, name
+}
+
+// Zet de inhoud van reader om naar UTF-8
+func decodeCharset(reader io.Reader, e encoding.Encoding, name string) io.Reader {
+	if name == "utf-8" || e == nil {
+		return reader
+	}
+	return transform.NewReader(reader, e.NewDecoder())
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCharsetDetection(test *testing.T) {
+	cases := []struct {
+		body        []byte
+		contentType string
+		charset     string
+		text        string
+	}{
+		// "Привет" in windows-1251, enkel aangegeven in een meta tag
+		{append([]byte("<html><head><meta charset=\"windows-1251\"></head><body>"), 0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2), "text/html", "windows-1251", "Привет"},
+
+		// "你好" in GBK, aangegeven in de header
+		{append([]byte("<html><body>"), 0xc4, 0xe3, 0xba, 0xc3), "text/html; charset=gbk", "gbk", "你好"},
+
+		// UTF-8 zonder aanduiding
+		{[]byte("<html><body>Grüße"), "text/html", "utf-8", "Grüße"},
+
+		// BOM heeft voorrang op de header
+		{append([]byte{0xef, 0xbb, 0xbf}, []byte("<html><body>Grüße")...), "text/html; charset=iso-8859-1", "utf-8", "Grüße"},
+	}
+
+	for _, c := range cases {
+		if !isHtmlResponse(c.body, c.contentType) {
+			test.Logf("%v not detected as html", c.charset)
+			test.Fail()
+			continue
+		}
+
+		e, name := detectCharset(c.body, c.contentType)
+		if name != c.charset {
+			test.Logf("Detected %v instead of %v", name, c.charset)
+			test.Fail()
+			continue
+		}
+
+		decoded, err := ioutil.ReadAll(decodeCharset(bytes.NewReader(c.body), e, name))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if !bytes.Contains(decoded, []byte(c.text)) {
+			test.Logf("Decoded %v document does not contain %v: %s", c.charset, c.text, decoded)
+			test.Fail()
+		}
+	}
+
+	if isHtmlResponse([]byte("{\"json\": true}"), "application/json") {
+		test.Log("JSON detected as html")
+		test.Fail()
+	}
+}
@@ -3,26 +3,127 @@ package crawler
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"github.com/SimonBackx/lantern-crawler/queries"
 	"os"
 	"time"
 )
 
 type CrawlerConfig struct {
-	UseTorProxy      bool
-	OnlyOnion        bool
-	LoadFromFiles    bool
-	MaxDomains       int /// 0 = infinite
-	Testing          bool
-	MaxTimeouts      int
-	MinTimeouts      int
-	MaxWorkers       int
-	InitialWorkers   int
-	TorDaemons       int
+	UseTorProxy    bool
+	OnlyOnion      bool
+	LoadFromFiles  bool
+	MaxDomains     int /// 0 = infinite
+	Testing        bool
+	MaxTimeouts    int
+	MinTimeouts    int
+	MaxWorkers     int
+	InitialWorkers int
+	TorDaemons     int
+
+	// Extern beheerde SOCKS5 proxies (bv. tor sidecars). Als deze lijst niet leeg is
+	// worden er geen tor daemons opgestart.
+	TorEndpoints        []distributors.SocksEndpoint
+	HealthCheckInterval int // seconden
+	TorBootstrapTimeout int // seconden
+
+	// Elke host over eigen tor circuits laten verlopen (IsolateSOCKSAuth). Niet mogelijk
+	// voor TorEndpoints met een eigen Username, die gebruiken hun vaste credentials
+	IsolateHosts bool
+
+	// Aantal timeouts na elkaar voor een host een nieuw circuit krijgt (0 = nooit)
+	NewCircuitAfterTimeouts int
+
+	// Keuze van de tor daemon voor een nieuwe worker: "latency" of "least-loaded"
+	TorSelection string
+
+	// Maximale grootte van PDF, DOCX en ODT bestanden in bytes (0 = niet crawlen)
+	MaxDocumentSize int
+
+	// Cryptomunt adressen, e-mailadressen, PGP sleutels en messenger ID's opslaan
+	ExtractIndicators bool
+
+	// Query parameters die uit url's verwijderd worden (sessies, tracking). "utm_*" = prefix
+	StripQueryParams []string
+
+	// Crawler traps: maximum herhalingen van een padsegment, aantal url's per patroon,
+	// queries per pad en bijna identieke pagina's per patroon voor quarantaine (0 = uit).
+	// Het aantal url's per patroon zegt op zich weinig (een groot forum heeft duizenden
+	// /viewtopic.php?t=#), daarom staan die limieten standaard uit.
+	TrapSegmentRepeatLimit int
+	TrapPatternLimit       int
+	TrapQueryVariantLimit  int
+	TrapDuplicateLimit     int
+	TrapQuarantineTime     int // minuten, 0 = blijvend
+
+	// Include/exclude regels per host of globaal, aangevuld met de regels van de API
+	CrawlRules []queries.CrawlRule
+
+	// JSON bestand met gehashte hosts, url patronen en gehashte inhoud die nooit
+	// gecrawld mogen worden, aangevuld met de blocklist van de API
+	BlocklistFile string
+
+	// User-Agent header van alle requests
+	UserAgent string
+
+	// robots.txt ophalen en Disallow en Crawl-delay toepassen (bedoeld voor clearnet).
+	// RobotsAgent is de naam waarop groepen in robots.txt gezocht worden,
+	// RobotsOverride de hosts die we ongeacht robots.txt mogen crawlen
+	RespectRobots  bool
+	RobotsAgent    string
+	RobotsOverride []string
+
+	// Sitemaps uit robots.txt en /sitemap.xml inlezen (bedoeld voor clearnet),
+	// met een maximum aantal url's per subdomein per dag
+	Sitemaps       bool
+	MaxSitemapUrls int
+
 	SleepAfter       int
 	SleepAfterRandom int
 
-	SleepTime       int
-	SleepTimeRandom int
+	// Recrawl intervallen in minuten. Elke pagina krijgt een eigen interval tussen
+	// min en max dat zich aanpast aan hoe vaak de inhoud wijzigt, RecrawlInterval is
+	// het startinterval. RecrawlMaxInterval 0 = alle pagina's elke cycle
+	RecrawlInterval    int
+	RecrawlMinInterval int
+	RecrawlMaxInterval int
+
+	// Voorsprong in minuten per punt score bij het wakker maken van workers.
+	// De score komt uit recente resultaten, nieuwe links, wijzigingen, fouten
+	// en het gewicht uit de crawl regels (0 = volgorde van aankomst)
+	PriorityAging int
+
+	// Budget per host per recrawl cycle en per dag: pagina's, KB over het netwerk
+	// en minuten dat de worker loopt (0 = onbeperkt). Een host zonder budget
+	// wacht tot de volgende cycle of dag
+	CycleMaxPages int
+	CycleMaxBytes int
+	CycleMaxTime  int
+	DayMaxPages   int
+	DayMaxBytes   int
+	DayMaxTime    int
+
+	// Token bucket per host: startsnelheid, grenzen voor de adaptieve snelheid
+	// (requests per seconde) en het aantal requests dat opgespaard kan worden
+	HostRate    float64
+	HostMinRate float64
+	HostMaxRate float64
+	HostBurst   int
+
+	// Aantal requests die tegelijk naar één host mogen lopen. Als HostMaxConcurrency
+	// groter is, past het aantal zich aan aan de snelheid en latency van de host
+	HostConcurrency    int
+	HostMaxConcurrency int
+
+	// Maximale totale downloadsnelheid van alle workers samen in KB/s (0 = onbeperkt)
+	MaxBandwidth int
+
+	// Afgewerkte diepe en genegeerde items enkel als hash bijhouden in plaats van als CrawlItem
+	CompactSeen bool
+
+	// Geheugengebruik in KB waarboven het aantal clients verlaagd wordt (0 = geen limiet).
+	// Pas onder 88% hiervan komen er terug clients bij
+	MaxMemory int
 
 	LogRecrawlingEnabled  bool
 	LogGoroutinesEnabled  bool
@@ -60,10 +161,54 @@ func ConfigFromFile() *CrawlerConfig {
 		InitialWorkers: 560,
 		TorDaemons:     20,
 
+		TorEndpoints:        []distributors.SocksEndpoint{},
+		HealthCheckInterval: 30,
+		TorBootstrapTimeout: 180,
+
+		IsolateHosts:            true,
+		NewCircuitAfterTimeouts: 3,
+		TorSelection:            "latency",
+
+		MaxDocumentSize:   20000000,
+		ExtractIndicators: true,
+		StripQueryParams:  defaultStripQueryParams,
+
+		TrapSegmentRepeatLimit: 3,
+		TrapPatternLimit:       0,
+		TrapQueryVariantLimit:  0,
+		TrapDuplicateLimit:     25,
+		TrapQuarantineTime:     10080,
+
+		CrawlRules:    []queries.CrawlRule{},
+		BlocklistFile: "/etc/lantern/blocklist.json",
+
+		UserAgent:      "Mozilla/5.0 (Windows NT 6.1; rv:45.0) Gecko/20100101 Firefox/45.0",
+		RespectRobots:  false,
+		RobotsAgent:    "LanternCrawler",
+		RobotsOverride: []string{},
+		Sitemaps:       false,
+		MaxSitemapUrls: 50000,
+
 		SleepAfter:       10,
 		SleepAfterRandom: 50,
-		SleepTime:        4000,
-		SleepTimeRandom:  4000,
+
+		RecrawlInterval:    720,
+		RecrawlMinInterval: 60,
+		RecrawlMaxInterval: 10080,
+
+		PriorityAging: 30,
+
+		HostRate:     0.2,
+		HostMinRate:  0.1,
+		HostMaxRate:  2,
+		HostBurst:    3,
+		MaxBandwidth: 0,
+
+		CompactSeen: true,
+		MaxMemory:   7000000,
+
+		HostConcurrency:    1,
+		HostMaxConcurrency: 1,
 
 		LogRecrawlingEnabled:  false,
 		LogGoroutinesEnabled:  false,
@@ -112,6 +257,16 @@ func (cfg *CrawlerConfig) Describe() {
 
 	if cfg.UseTorProxy {
 		cfg.LogInfo("Crawling tor")
+		if len(cfg.TorEndpoints) > 0 {
+			cfg.LogInfo(fmt.Sprintf("Using %v external SOCKS endpoints", len(cfg.TorEndpoints)))
+		}
+		if cfg.IsolateHosts {
+			for _, endpoint := range cfg.TorEndpoints {
+				if len(endpoint.Username) > 0 {
+					cfg.Log("Warning", "No host isolation for "+endpoint.String()+" (has its own SOCKS credentials)")
+				}
+			}
+		}
 		if !cfg.OnlyOnion {
 			cfg.Log("Warning", "OnlyOnion disabled")
 		}
@@ -137,4 +292,28 @@ func (cfg *CrawlerConfig) Describe() {
 	if cfg.ForceRecrawl {
 		cfg.LogInfo("ForceRecrawl")
 	}
+
+	if cfg.MaxBandwidth > 0 {
+		cfg.LogInfo(fmt.Sprintf("MaxBandwidth = %v KB/s", cfg.MaxBandwidth))
+	}
+
+	if cfg.AdaptiveRecrawl() {
+		cfg.LogInfo(fmt.Sprintf("Recrawl interval %v - %v minutes (start %v)", cfg.RecrawlMinInterval, cfg.RecrawlMaxInterval, cfg.RecrawlInterval))
+	}
+
+	if cfg.PriorityAging > 0 {
+		cfg.LogInfo(fmt.Sprintf("Host priority: %v minutes per point", cfg.PriorityAging))
+	}
+
+	if cfg.HasBudget() {
+		cfg.LogInfo(fmt.Sprintf("Host budget per cycle: %v pages, %v KB, %v min; per day: %v pages, %v KB, %v min", cfg.CycleMaxPages, cfg.CycleMaxBytes, cfg.CycleMaxTime, cfg.DayMaxPages, cfg.DayMaxBytes, cfg.DayMaxTime))
+	}
+
+	if cfg.RespectRobots {
+		cfg.LogInfo(fmt.Sprintf("Respecting robots.txt as %v (%v hosts overridden)", cfg.RobotsAgent, len(cfg.RobotsOverride)))
+	}
+}
+
+func (cfg *CrawlerConfig) HasBudget() bool {
+	return cfg.CycleMaxPages > 0 || cfg.CycleMaxBytes > 0 || cfg.CycleMaxTime > 0 || cfg.DayMaxPages > 0 || cfg.DayMaxBytes > 0 || cfg.DayMaxTime > 0
 }
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"strings"
+)
+
+// Compressie die we aan servers aanbieden
+const acceptEncoding = "gzip, deflate, br"
+
+// Geeft een reader terug die de body decomprimeert volgens
+// de Content-Encoding header. Bij meerdere encodings werden die in volgorde toegepast,
+// dus decomprimeren we in omgekeerde volgorde.
+func decodeContentEncoding(body io.Reader, contentEncoding string) (io.Reader, error) {
+	reader := body
+
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		reader, err = newDecompressor(reader, strings.ToLower(strings.TrimSpace(encodings[i])))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+func newDecompressor(reader io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "", "identity":
+		return reader, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(reader)
+	case "deflate":
+		// Volgens de spec zlib, maar veel servers sturen raw deflate
+		buffered := bufio.NewReader(reader)
+		header, err := buffered.Peek(2)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if isZlibHeader(header) {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case "br":
+		return brotli.NewReader(reader), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %v", encoding)
+}
+
+// Een zlib header bestaat uit CMF en FLG, waarbij CMF deflate aangeeft
+// en CMF*256 + FLG een veelvoud van 31 is (RFC 1950)
+func isZlibHeader(header []byte) bool {
+	if len(header) < 2 {
+		return false
+	}
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
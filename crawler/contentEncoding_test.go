@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func compress(test *testing.T, encoding string, data []byte) []byte {
+	buffer := bytes.NewBuffer(nil)
+	var writer io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(buffer)
+	case "deflate":
+		writer = zlib.NewWriter(buffer)
+	case "raw-deflate":
+		writer, _ = flate.NewWriter(buffer, flate.DefaultCompression)
+	case "br":
+		writer = brotli.NewWriter(buffer)
+	default:
+		test.Fatal("unknown encoding " + encoding)
+	}
+
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestContentEncoding(test *testing.T) {
+	data := bytes.Repeat([]byte("<html><body>hello world</body></html>"), 100)
+
+	cases := map[string]string{
+		"gzip":        "gzip",
+		"deflate":     "deflate",
+		"raw-deflate": "deflate",
+		"br":          "br",
+	}
+
+	for compression, header := range cases {
+		reader, err := decodeContentEncoding(bytes.NewReader(compress(test, compression, data)), header)
+		if err != nil {
+			test.Logf("%v: %v", compression, err)
+			test.Fail()
+			continue
+		}
+
+		decoded, err := ioutil.ReadAll(reader)
+		if err != nil || !bytes.Equal(decoded, data) {
+			test.Logf("%v not decoded correctly (%v)", compression, err)
+			test.Fail()
+		}
+	}
+
+	// Meerdere encodings na elkaar
+	reader, err := decodeContentEncoding(bytes.NewReader(compress(test, "br", compress(test, "gzip", data))), "gzip, br")
+	if err == nil {
+		decoded, _ := ioutil.ReadAll(reader)
+		if !bytes.Equal(decoded, data) {
+			test.Log("Stacked encodings not decoded correctly")
+			test.Fail()
+		}
+	} else {
+		test.Log(err)
+		test.Fail()
+	}
+
+	if _, err := decodeContentEncoding(bytes.NewReader(data), "compress"); err == nil {
+		test.Log("Unsupported encoding accepted")
+		test.Fail()
+	}
+}
+
+func TestCompressionBomb(test *testing.T) {
+	bomb := compress(test, "gzip", make([]byte, maxFileSize*5))
+
+	reader, err := decodeContentEncoding(bytes.NewReader(bomb), "gzip")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	counting := NewCountingReader(reader, maxFileSize)
+	_, err = ioutil.ReadAll(counting)
+	if err == nil || counting.Size > maxFileSize+64*1024 {
+		test.Logf("Compression bomb not cut off (%v bytes read)", counting.Size)
+		test.Fail()
+	}
+}
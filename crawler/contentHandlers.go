@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+)
+
+// Zet de (UTF-8) inhoud van een document om in doorzoekbare tekst (Lowercased) en gevonden links
+type ContentHandler func(data []byte, parseUrls bool) *ParseResult
+
+// Ondersteunde media types. Alles wat hier niet in staat wordt genegeerd
+var contentHandlers = map[string]ContentHandler{
+	"text/html":             ReadHtml,
+	"application/xhtml+xml": ReadHtml,
+	"text/plain":            ReadText,
+	"text/csv":              ReadText,
+	"application/json":      ReadJson,
+	"text/xml":              ReadXml,
+	"application/xml":       ReadXml,
+
+	mediaTypePdf:  ReadPdf,
+	mediaTypeDocx: ReadDocx,
+	mediaTypeOdt:  ReadOdt,
+}
+
+var textUrlRegexp = regexp.MustCompile(`(?i)https?://[^\s"'<>()\[\]{}\\^` + "`" + `]+`)
+
+// Bepaalt het media type van een response op basis van de eerste bytes en de
+// Content-Type header. Geeft een lege string terug als het geen tekst is.
+func detectMediaType(firstBytes []byte, contentType string) string {
+	if isHtmlResponse(firstBytes, contentType) {
+		return "text/html"
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(firstBytes))
+	if sniffed != "text/plain" && sniffed != "text/xml" {
+		// Binaire data, wat de header ook zegt
+		return ""
+	}
+
+	header, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		if _, found := contentHandlers[header]; found {
+			return header
+		}
+	}
+	return sniffed
+}
+
+// Platte tekst: alles is doorzoekbaar, url's zoeken we met een regexp
+func ReadText(data []byte, parseUrls bool) *ParseResult {
+	result := &ParseResult{Links: make([]*FoundLink, 0)}
+	result.Lowercased = bytes.ToLower(data)
+	result.Visible = data
+
+	if parseUrls {
+		result.Links = findUrlsInText(data)
+	}
+	return result
+}
+
+// Object of array dat ReadJson aan het overlopen is
+type jsonContainer struct {
+	object    bool
+	expectKey bool
+}
+
+// JSON: enkel de string waarden zijn doorzoekbaar, keys niet
+func ReadJson(data []byte, parseUrls bool) *ParseResult {
+	result := &ParseResult{Links: make([]*FoundLink, 0)}
+	lowercased := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	visible := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+
+	stack := make([]jsonContainer, 0, 8)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			// Ongeldige JSON, dan maar als tekst behandelen
+			return ReadText(data, parseUrls)
+		}
+
+		var parent *jsonContainer
+		if len(stack) > 0 {
+			parent = &stack[len(stack)-1]
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				if parent != nil && parent.object {
+					// Na deze waarde volgt terug een key
+					parent.expectKey = true
+				}
+				stack = append(stack, jsonContainer{object: delim == '{', expectKey: delim == '{'})
+			default:
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		if parent != nil && parent.object {
+			parent.expectKey = !parent.expectKey
+			if !parent.expectKey {
+				// Dit was een key, volgende token is de waarde
+				continue
+			}
+		}
+
+		str, ok := token.(string)
+		if !ok {
+			continue
+		}
+
+		visible.WriteByte(0)
+		visible.WriteString(str)
+
+		lowercased.WriteByte(0)
+		lowercased.Write(bytes.ToLower([]byte(str)))
+
+		if parseUrls {
+			result.Links = append(result.Links, findUrlsInText([]byte(str))...)
+		}
+	}
+
+	result.Lowercased = lowercased.Bytes()
+	result.Visible = visible.Bytes()
+	return result
+}
+
+// XML: tekst tussen tags is doorzoekbaar, url's kunnen ook in attributen staan
+func ReadXml(data []byte, parseUrls bool) *ParseResult {
+	result := &ParseResult{Links: make([]*FoundLink, 0)}
+	lowercased := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	visible := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	// Charset werd al omgezet naar UTF-8
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return ReadText(data, parseUrls)
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text := bytes.TrimSpace(t)
+			if len(text) == 0 {
+				continue
+			}
+
+			visible.WriteByte(0)
+			visible.Write(text)
+
+			lowercased.WriteByte(0)
+			lowercased.Write(bytes.ToLower(text))
+
+			if parseUrls {
+				result.Links = append(result.Links, findUrlsInText(text)...)
+			}
+		case xml.StartElement:
+			if !parseUrls {
+				continue
+			}
+
+			for _, attr := range t.Attr {
+				result.Links = append(result.Links, findUrlsInText([]byte(attr.Value))...)
+			}
+		}
+	}
+
+	result.Lowercased = lowercased.Bytes()
+	result.Visible = visible.Bytes()
+	return result
+}
+
+func findUrlsInText(text []byte) []*FoundLink {
+	links := make([]*FoundLink, 0)
+	for _, match := range textUrlRegexp.FindAll(text, -1) {
+		// Leestekens op het einde horen meestal niet bij de url
+		match = bytes.TrimRight(match, ".,;:!?")
+
+		if link := newFoundLink(match, LinkTypeText); link != nil {
+			links = append(links, link)
+		}
+	}
+	return links
+}
@@ -0,0 +1,79 @@
+package crawler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectMediaType(test *testing.T) {
+	cases := []struct {
+		data        string
+		contentType string
+		expected    string
+	}{
+		{"<!DOCTYPE html><html><body>hallo</body></html>", "", "text/html"},
+		{"gewone tekst", "text/plain; charset=utf-8", "text/plain"},
+		{`{"key": "value"}`, "application/json", "application/json"},
+		{"<?xml version=\"1.0\"?><root/>", "application/xml", "application/xml"},
+		{"a,b,c\n1,2,3", "text/csv", "text/csv"},
+		{"paste zonder header", "", "text/plain"},
+		{"\x00\x01\x02\x03binary", "text/plain", ""},
+		{"%PDF-1.4", "application/pdf", ""},
+	}
+
+	for _, c := range cases {
+		if mediaType := detectMediaType([]byte(c.data), c.contentType); mediaType != c.expected {
+			test.Logf("%q (%s) detected as %q, expected %q", c.data, c.contentType, mediaType, c.expected)
+			test.Fail()
+		}
+	}
+}
+
+func TestReadText(test *testing.T) {
+	result := ReadText([]byte("Dump van LEAKS\nZie http://example.onion/page, of https://test.com."), true)
+
+	if !bytes.Contains(result.Lowercased, []byte("dump van leaks")) {
+		test.Log("Text not lowercased")
+		test.Fail()
+	}
+
+	if len(result.Links) != 2 || result.Links[0].Url.String() != "http://example.onion/page" || result.Links[1].Url.String() != "https://test.com" {
+		test.Logf("Wrong urls found: %v", result.Links)
+		test.Fail()
+	}
+}
+
+func TestReadJson(test *testing.T) {
+	result := ReadJson([]byte(`{"Title": "Hallo WERELD", "links": ["http://example.onion/"], "nested": {"count": 3, "key": "waarde"}, "list": [{"a": "b"}]}`), true)
+
+	if !bytes.Contains(result.Lowercased, []byte("hallo wereld")) || bytes.Contains(result.Lowercased, []byte("count")) || !bytes.Contains(result.Lowercased, []byte("waarde")) || !bytes.Contains(result.Lowercased, []byte("\x00b")) || bytes.Contains(result.Lowercased, []byte("\x00a")) {
+		test.Logf("Wrong searchable text %q", result.Lowercased)
+		test.Fail()
+	}
+
+	if len(result.Links) != 1 || result.Links[0].Url.String() != "http://example.onion/" {
+		test.Logf("Wrong urls found: %v", result.Links)
+		test.Fail()
+	}
+
+	// Ongeldige JSON wordt als tekst behandeld
+	result = ReadJson([]byte(`{"broken": "Tekst`), false)
+	if !bytes.Contains(result.Lowercased, []byte("tekst")) {
+		test.Log("Invalid JSON not handled as text")
+		test.Fail()
+	}
+}
+
+func TestReadXml(test *testing.T) {
+	result := ReadXml([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><feed><item href="http://a.onion/">Nieuw ARTIKEL</item></feed>`), true)
+
+	if !bytes.Contains(result.Lowercased, []byte("nieuw artikel")) {
+		test.Logf("Wrong searchable text %q", result.Lowercased)
+		test.Fail()
+	}
+
+	if len(result.Links) != 1 || result.Links[0].Url.String() != "http://a.onion/" {
+		test.Logf("Wrong urls found: %v", result.Links)
+		test.Fail()
+	}
+}
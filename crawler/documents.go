@@ -0,0 +1,281 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/ledongthuc/pdf"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	mediaTypePdf  = "application/pdf"
+	mediaTypeDocx = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mediaTypeOdt  = "application/vnd.oasis.opendocument.text"
+)
+
+// Maximale grootte van de XML in een DOCX of ODT (zip bommen)
+const maxDocumentXmlSize = 50000000
+
+// Documenten worden niet als tekst ingelezen (geen charset) en hebben een eigen
+// maximale grootte (MaxDocumentSize)
+func isDocumentType(mediaType string) bool {
+	return mediaType == mediaTypePdf || mediaType == mediaTypeDocx || mediaType == mediaTypeOdt
+}
+
+// Herkent PDF, DOCX en ODT. DOCX en ODT zijn zip bestanden, daarvoor
+// vertrouwen we de header of de extensie in de url.
+func detectDocumentType(firstBytes []byte, contentType string, urlPath string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(firstBytes))
+	if sniffed == mediaTypePdf {
+		return mediaTypePdf
+	}
+
+	if sniffed != "application/zip" {
+		return ""
+	}
+
+	// ODT bevat als eerste (ongecomprimeerd) bestand het mimetype
+	if bytes.Contains(firstBytes, []byte("mimetype"+mediaTypeOdt)) {
+		return mediaTypeOdt
+	}
+
+	header, _, _ := mime.ParseMediaType(contentType)
+	if header == mediaTypeDocx || header == mediaTypeOdt {
+		return header
+	}
+
+	switch strings.ToLower(path.Ext(urlPath)) {
+	case ".docx":
+		return mediaTypeDocx
+	case ".odt":
+		return mediaTypeOdt
+	}
+	return ""
+}
+
+func ReadPdf(data []byte, parseUrls bool) *ParseResult {
+	pages, err := extractPdfPages(data)
+	if err != nil {
+		pages = nil
+	}
+	return newDocumentResult(pages, parseUrls)
+}
+
+func ReadDocx(data []byte, parseUrls bool) *ParseResult {
+	pages, err := extractZippedXml(data, "word/document.xml", docxTextElements)
+	if err != nil {
+		pages = nil
+	}
+	return newDocumentResult(pages, parseUrls)
+}
+
+func ReadOdt(data []byte, parseUrls bool) *ParseResult {
+	pages, err := extractZippedXml(data, "content.xml", odtTextElements)
+	if err != nil {
+		pages = nil
+	}
+	return newDocumentResult(pages, parseUrls)
+}
+
+// Zet de tekst van elke pagina om in een ParseResult. Elke pagina wordt apart
+// doorzocht zodat het paginanummer in de snippet kan komen.
+func newDocumentResult(pages []string, parseUrls bool) *ParseResult {
+	result := &ParseResult{Links: make([]*FoundLink, 0)}
+	text := bytes.NewBuffer(make([]byte, 0, 1024))
+
+	for _, page := range pages {
+		text.WriteString(page)
+		text.WriteByte('\n')
+
+		result.Pages = append(result.Pages, bytes.ToLower([]byte(page)))
+		if parseUrls {
+			result.Links = append(result.Links, findUrlsInText([]byte(page))...)
+		}
+	}
+
+	result.Text = text.Bytes()
+	result.Visible = result.Text
+	result.Lowercased = bytes.ToLower(result.Text)
+	return result
+}
+
+func extractPdfPages(data []byte) (pages []string, err error) {
+	// De pdf library kan panic'en op ongeldige bestanden
+	defer func() {
+		if r := recover(); r != nil {
+			pages = nil
+			err = errors.New("invalid pdf")
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	count := reader.NumPage()
+	pages = make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		text, err := reader.Page(i).GetPlainText(nil)
+		if err != nil {
+			// Pagina overslaan, maar nummering behouden
+			text = ""
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+// Wat een XML element betekent voor de tekst van een document
+type documentElement int
+
+const (
+	documentElementText documentElement = iota
+	documentElementParagraph
+	documentElementTab
+	documentElementSpace
+	documentElementLineBreak
+	documentElementPageBreak
+)
+
+var docxTextElements = map[string]documentElement{
+	"t":                     documentElementText,
+	"p":                     documentElementParagraph,
+	"tab":                   documentElementTab,
+	"br":                    documentElementLineBreak,
+	"lastRenderedPageBreak": documentElementPageBreak,
+}
+
+var odtTextElements = map[string]documentElement{
+	"p":               documentElementParagraph,
+	"h":               documentElementParagraph,
+	"tab":             documentElementTab,
+	"s":               documentElementSpace,
+	"line-break":      documentElementLineBreak,
+	"soft-page-break": documentElementPageBreak,
+}
+
+// Leest de tekst uit een XML bestand in een zip (DOCX en ODT), opgesplitst
+// in pagina's volgens de pagina-einden die de tekstverwerker heeft opgeslagen.
+func extractZippedXml(data []byte, name string, elements map[string]documentElement) ([]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return extractXmlPages(io.LimitReader(reader, maxDocumentXmlSize), elements)
+	}
+	return nil, errors.New(name + " not found in document")
+}
+
+func extractXmlPages(reader io.Reader, elements map[string]documentElement) ([]string, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+
+	pages := make([]string, 0, 1)
+	page := bytes.NewBuffer(make([]byte, 0, 1024))
+
+	// DOCX heeft tekst enkel in <w:t>, in ODT staat alle tekst in de paragrafen
+	textDepth := 0
+	_, textElements := elements["t"]
+
+	// Word bewaart na een harde pagina-einde ook nog een lastRenderedPageBreak,
+	// lege pagina's tellen we daarom niet
+	breakPage := func() {
+		if len(bytes.TrimSpace(page.Bytes())) == 0 && len(pages) > 0 {
+			return
+		}
+		pages = append(pages, page.String())
+		page.Reset()
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			// Afgebroken document: wat we hebben is nog bruikbaar
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element, found := elements[t.Name.Local]
+			if !found {
+				continue
+			}
+
+			switch element {
+			case documentElementText:
+				textDepth++
+			case documentElementParagraph:
+				if !textElements {
+					textDepth++
+				}
+			case documentElementTab:
+				page.WriteByte('\t')
+			case documentElementSpace:
+				page.WriteByte(' ')
+			case documentElementLineBreak:
+				if pageBreakAttribute(t) {
+					breakPage()
+				} else {
+					page.WriteByte('\n')
+				}
+			case documentElementPageBreak:
+				breakPage()
+			}
+
+		case xml.EndElement:
+			element, found := elements[t.Name.Local]
+			if !found {
+				continue
+			}
+
+			if element == documentElementText || (element == documentElementParagraph && !textElements) {
+				textDepth--
+			}
+
+			if element == documentElementParagraph {
+				page.WriteByte('\n')
+			}
+
+		case xml.CharData:
+			if textDepth > 0 {
+				page.Write(t)
+			}
+		}
+	}
+
+	pages = append(pages, page.String())
+	return pages, nil
+}
+
+// <w:br w:type="page"/> is een harde pagina-einde in DOCX
+func pageBreakAttribute(element xml.StartElement) bool {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == "type" && attr.Value == "page" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"strings"
+	"testing"
+)
+
+// Minimale PDF met één tekstregel per pagina
+func makePdf(pages []string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	kids := make([]string, 0, len(pages))
+	for _, text := range pages {
+		content := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buffer.Bytes()
+}
+
+func makeZip(test *testing.T, files map[string]string, order []string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, name := range order {
+		method := zip.Deflate
+		if name == "mimetype" {
+			method = zip.Store
+		}
+
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			test.Fatal(err)
+		}
+		file.Write([]byte(files[name]))
+	}
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestReadPdf(test *testing.T) {
+	data := makePdf([]string{"Eerste pagina", "Gelekte DATABASE dump", "Derde pagina"})
+
+	if mediaType := detectDocumentType(data, "application/octet-stream", "/file"); mediaType != mediaTypePdf {
+		test.Logf("PDF detected as %q", mediaType)
+		test.Fail()
+	}
+
+	result, err := Parse(bytes.NewReader(data), contentHandlers[mediaTypePdf], []queries.Query{
+		*queries.NewQuery("test", &queries.TextQuery{Text: "database"}),
+	}, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(result.Pages) != 3 {
+		test.Fatalf("Expected 3 pages, got %v", len(result.Pages))
+	}
+
+	if len(result.Results) != 1 || !strings.HasPrefix(*result.Results[0].Snippet, "Page 2: ") {
+		test.Logf("Expected result on page 2: %v", result.Results)
+		test.Fail()
+	} else if !strings.Contains(*result.Results[0].Body, "Gelekte DATABASE dump") {
+		test.Log("Body should contain the extracted text")
+		test.Fail()
+	}
+
+	// Ongeldige PDF mag geen panic veroorzaken
+	broken := ReadPdf([]byte("%PDF-1.4\n1 0 obj garbage"), true)
+	if len(broken.Lowercased) != 0 {
+		test.Log("Broken PDF should have no text")
+		test.Fail()
+	}
+}
+
+func TestReadDocx(test *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Losgeld</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve"> BETALEN </w:t></w:r></w:p>
+<w:p><w:r><w:br w:type="page"/></w:r></w:p>
+<w:p><w:r><w:lastRenderedPageBreak/><w:t>Contact via http://example.onion/</w:t></w:r></w:p>
+</w:body></w:document>`
+
+	data := makeZip(test, map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml":   document,
+	}, []string{"[Content_Types].xml", "word/document.xml"})
+
+	if mediaType := detectDocumentType(data, "application/octet-stream", "/notes.DOCX"); mediaType != mediaTypeDocx {
+		test.Logf("DOCX detected as %q", mediaType)
+		test.Fail()
+	}
+
+	result := ReadDocx(data, true)
+	if len(result.Pages) != 2 {
+		test.Fatalf("Expected 2 pages, got %q", result.Pages)
+	}
+
+	if !bytes.Contains(result.Pages[0], []byte("losgeld\t betalen")) || !bytes.Contains(result.Pages[1], []byte("contact via")) {
+		test.Logf("Wrong text %q", result.Pages)
+		test.Fail()
+	}
+
+	if len(result.Links) != 1 || result.Links[0].Url.String() != "http://example.onion/" {
+		test.Logf("Wrong urls %v", result.Links)
+		test.Fail()
+	}
+}
+
+func TestReadOdt(test *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>
+<text:h>Titel</text:h><text:p>Eerste<text:s/>alinea</text:p>
+<text:p><text:soft-page-break/>Tweede PAGINA</text:p>
+</office:text></office:body></office:document-content>`
+
+	data := makeZip(test, map[string]string{
+		"mimetype":    mediaTypeOdt,
+		"content.xml": content,
+	}, []string{"mimetype", "content.xml"})
+
+	if mediaType := detectDocumentType(data, "", "/download"); mediaType != mediaTypeOdt {
+		test.Logf("ODT detected as %q", mediaType)
+		test.Fail()
+	}
+
+	result := ReadOdt(data, false)
+	if len(result.Pages) != 2 || !bytes.Contains(result.Pages[0], []byte("eerste alinea")) || !bytes.Contains(result.Pages[1], []byte("tweede pagina")) {
+		test.Logf("Wrong pages %q", result.Pages)
+		test.Fail()
+	}
+}
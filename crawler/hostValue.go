@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"math"
+	"time"
+)
+
+// Na een week tellen resultaten, links en fouten nog maar half mee
+const hostValueHalfLife = 7 * 24 * time.Hour
+
+// Maximale score, zo blijft de voorsprong in de SleepingCrawlers begrensd
+const maxHostScore = 10
+
+// Score van een host zonder geschiedenis: tussen een waardeloze en een goede host in
+const unknownHostScore = 1.5
+
+// Recente opbrengst van een host. Alle tellers nemen exponentieel af met de tijd.
+// Enkel aanpassen vanuit de worker, de crawler leest de score als de worker niet loopt.
+type HostValue struct {
+	Requests float64
+	Failures float64
+	Results  float64
+	NewLinks float64
+	Changes  float64
+
+	updated time.Time
+}
+
+func (v *HostValue) decay(now time.Time) {
+	if !v.updated.IsZero() {
+		factor := math.Pow(0.5, float64(now.Sub(v.updated))/float64(hostValueHalfLife))
+		v.Requests *= factor
+		v.Failures *= factor
+		v.Results *= factor
+		v.NewLinks *= factor
+		v.Changes *= factor
+	}
+	v.updated = now
+}
+
+func (v *HostValue) Request() {
+	v.decay(time.Now())
+	v.Requests++
+}
+
+func (v *HostValue) Failure() {
+	v.decay(time.Now())
+	v.Failures++
+}
+
+func (v *HostValue) Result(count int) {
+	v.decay(time.Now())
+	v.Results += float64(count)
+}
+
+func (v *HostValue) NewLink() {
+	v.decay(time.Now())
+	v.NewLinks++
+}
+
+func (v *HostValue) Change() {
+	v.decay(time.Now())
+	v.Changes++
+}
+
+// Score tussen 0 en maxHostScore: resultaten van queries wegen het zwaarst, daarna
+// het ontdekken van nieuwe pagina's en hoe vaak de inhoud wijzigt. Fouten verlagen de score.
+func (v *HostValue) Score(weight float64) float64 {
+	if v.Requests+v.Failures < 1 {
+		return math.Min(unknownHostScore*weight, maxHostScore)
+	}
+
+	score := 1.0
+	score += 2 * v.Results / (v.Results + 5)
+	score += math.Min(v.NewLinks/(v.Requests+1), 1)
+	score += math.Min(v.Changes/(v.Requests+1), 1)
+	score *= 1 - 0.75*v.Failures/(v.Requests+v.Failures)
+
+	return math.Min(score*weight, maxHostScore)
+}
+
+// Score van deze host voor het wakker maken uit de SleepingCrawlers
+func (w *Hostworker) Priority() float64 {
+	return w.Value.Score(w.crawler.Rules.Weight(w.Host))
+}
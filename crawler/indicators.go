@@ -0,0 +1,307 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"golang.org/x/crypto/sha3"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Aantal tekens rond een indicator dat als context wordt bijgehouden
+const indicatorContextLength = 60
+
+// Maximale grootte van een PGP key block
+const maxPgpKeyLength = 64 * 1024
+
+// Zoekt kandidaten in de tekst. Geeft de waarde terug als die geldig is, anders een lege string.
+type indicatorExtractor struct {
+	Type     string
+	Regexp   *regexp.Regexp
+	Validate func(match []byte, submatch []byte) string
+}
+
+var indicatorExtractors = []indicatorExtractor{
+	{queries.IndicatorBitcoin, regexp.MustCompile(`\b[13][1-9A-HJ-NP-Za-km-z]{25,34}\b`), validateBitcoinBase58},
+	{queries.IndicatorBitcoin, regexp.MustCompile(`(?i)\bbc1[02-9ac-hj-np-z]{8,87}\b`), validateBitcoinBech32},
+	{queries.IndicatorMonero, regexp.MustCompile(`\b[48][1-9A-HJ-NP-Za-km-z]{94}(?:[1-9A-HJ-NP-Za-km-z]{11})?\b`), validateMonero},
+	{queries.IndicatorEthereum, regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`), validateEthereum},
+	{queries.IndicatorPgpKey, regexp.MustCompile(`(?s)-----BEGIN PGP PUBLIC KEY BLOCK-----.+?-----END PGP PUBLIC KEY BLOCK-----`), validatePgpKey},
+	{queries.IndicatorPgpFingerprint, regexp.MustCompile(`(?i)fingerprint[^0-9a-f\n\x00]{0,20}((?:[0-9a-f]{4} {0,2}){9}[0-9a-f]{4})\b`), validatePgpFingerprint},
+	{queries.IndicatorJabber, regexp.MustCompile(`(?i)(?:jabber|xmpp|jid)[^a-z0-9\n\x00]{1,5}([a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,})\b`), validateHandle},
+	{queries.IndicatorTelegram, regexp.MustCompile(`(?i)(?:\bt\.me/|\btelegram\.me/|telegram[^a-z0-9\n\x00]{1,10}@)([a-z][a-z0-9_]{4,31})\b`), validateHandle},
+	{queries.IndicatorWickr, regexp.MustCompile(`(?i)\bwickr(?:\s*me)?(?:\s*id)?[^a-z0-9\n\x00]{1,5}([a-z0-9][a-z0-9_.-]{4,31})\b`), validateHandle},
+	{queries.IndicatorEmail, regexp.MustCompile(`\b[a-zA-Z0-9._%+-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,}\b`), validateEmail},
+}
+
+// Zoekt alle indicators in de zichtbare tekst van een pagina. Elke waarde komt maar één keer voor,
+// Occurrences telt het aantal vermeldingen.
+func ExtractIndicators(text []byte) []*queries.Indicator {
+	indicators := make([]*queries.Indicator, 0)
+	found := make(map[string]*queries.Indicator)
+
+	for _, extractor := range indicatorExtractors {
+		for _, match := range extractor.Regexp.FindAllSubmatchIndex(text, -1) {
+			var submatch []byte
+			if len(match) >= 4 && match[2] >= 0 {
+				submatch = text[match[2]:match[3]]
+			}
+
+			value := extractor.Validate(text[match[0]:match[1]], submatch)
+			if len(value) == 0 {
+				continue
+			}
+
+			// Jabber adressen zijn ook e-mailadressen, die niet dubbel rapporteren
+			if extractor.Type == queries.IndicatorEmail && found[queries.IndicatorJabber+"\t"+value] != nil {
+				continue
+			}
+
+			key := extractor.Type + "\t" + value
+			if indicator := found[key]; indicator != nil {
+				indicator.Occurrences++
+				continue
+			}
+
+			indicator := queries.NewIndicator(extractor.Type, value, indicatorContext(text, match[0], match[1]))
+			found[key] = indicator
+			indicators = append(indicators, indicator)
+		}
+	}
+	return indicators
+}
+
+func indicatorContext(text []byte, start, end int) *string {
+	start -= indicatorContextLength
+	if start < 0 {
+		start = 0
+	}
+
+	end += indicatorContextLength
+	if end > len(text) {
+		end = len(text)
+	}
+
+	context := string(bytes.Replace(text[start:end], []byte{0}, []byte(" "), -1))
+	return queries.CleanString(&context)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Base58 zoals gebruikt door Bitcoin. Voorloopnullen worden als '1' gecodeerd.
+func decodeBase58(str []byte) []byte {
+	number := big.NewInt(0)
+	radix := big.NewInt(58)
+
+	zeros := 0
+	for zeros < len(str) && str[zeros] == '1' {
+		zeros++
+	}
+
+	for _, c := range str {
+		index := strings.IndexByte(base58Alphabet, c)
+		if index < 0 {
+			return nil
+		}
+		number.Mul(number, radix)
+		number.Add(number, big.NewInt(int64(index)))
+	}
+
+	return append(make([]byte, zeros), number.Bytes()...)
+}
+
+// P2PKH (1...) en P2SH (3...) adressen: versie, hash en 4 bytes checksum
+func validateBitcoinBase58(match []byte, submatch []byte) string {
+	decoded := decodeBase58(match)
+	if len(decoded) != 25 || (decoded[0] != 0x00 && decoded[0] != 0x05) {
+		return ""
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[21:]) {
+		return ""
+	}
+	return string(match)
+}
+
+const bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+// Segwit adressen (BIP 173 en BIP 350)
+func validateBitcoinBech32(match []byte, submatch []byte) string {
+	address := string(match)
+	if address != strings.ToLower(address) && address != strings.ToUpper(address) {
+		// Gemengde hoofdletters zijn niet toegelaten
+		return ""
+	}
+	address = strings.ToLower(address)
+
+	data := make([]byte, 0, len(address))
+	for _, c := range address[3:] {
+		data = append(data, byte(strings.IndexRune(bech32Alphabet, c)))
+	}
+
+	if len(data) < 7 || data[0] > 16 {
+		return ""
+	}
+
+	// Uitgebreide hrp "bc" gevolgd door de data
+	values := []byte{'b' >> 5, 'c' >> 5, 0, 'b' & 31, 'c' & 31}
+	values = append(values, data...)
+
+	constant := uint32(1)
+	if data[0] > 0 {
+		// Bech32m voor witness versie 1 en hoger
+		constant = 0x2bc830a3
+	}
+
+	if bech32Polymod(values) != constant {
+		return ""
+	}
+
+	// Lengte van het witness programma controleren
+	programBits := (len(data) - 7) * 5
+	programLength := programBits / 8
+	if programLength < 2 || programLength > 40 || (data[0] == 0 && programLength != 20 && programLength != 32) {
+		return ""
+	}
+	return address
+}
+
+// Monero base58 codeert blokken van 8 bytes in 11 tekens
+var moneroBlockSizes = map[int]int{2: 1, 3: 2, 5: 3, 6: 4, 7: 5, 9: 6, 10: 7, 11: 8}
+
+func decodeMoneroBase58(str []byte) []byte {
+	decoded := make([]byte, 0, len(str)*8/11+8)
+	for start := 0; start < len(str); start += 11 {
+		end := start + 11
+		if end > len(str) {
+			end = len(str)
+		}
+
+		size, ok := moneroBlockSizes[end-start]
+		if !ok {
+			return nil
+		}
+
+		number := big.NewInt(0)
+		for _, c := range str[start:end] {
+			index := strings.IndexByte(base58Alphabet, c)
+			if index < 0 {
+				return nil
+			}
+			number.Mul(number, big.NewInt(58))
+			number.Add(number, big.NewInt(int64(index)))
+		}
+
+		block := number.Bytes()
+		if len(block) > size {
+			return nil
+		}
+		decoded = append(decoded, make([]byte, size-len(block))...)
+		decoded = append(decoded, block...)
+	}
+	return decoded
+}
+
+// Standaard adressen, subadressen en integrated adressen van het hoofdnetwerk
+func validateMonero(match []byte, submatch []byte) string {
+	decoded := decodeMoneroBase58(match)
+	if len(decoded) != 69 && len(decoded) != 77 {
+		return ""
+	}
+
+	switch decoded[0] {
+	case 18, 42:
+		if len(decoded) != 69 {
+			return ""
+		}
+	case 19:
+		if len(decoded) != 77 {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(decoded[:len(decoded)-4])
+	if !bytes.Equal(hash.Sum(nil)[:4], decoded[len(decoded)-4:]) {
+		return ""
+	}
+	return string(match)
+}
+
+// Adressen met gemengde hoofdletters hebben een EIP-55 checksum
+func validateEthereum(match []byte, submatch []byte) string {
+	address := string(match[2:])
+	lower := strings.ToLower(address)
+	if address == lower || address == strings.ToUpper(address) {
+		return "0x" + lower
+	}
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(lower))
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	for i := 0; i < len(address); i++ {
+		c := address[i]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+
+		upper := digest[i] >= '8'
+		if upper != (c >= 'A' && c <= 'F') {
+			return ""
+		}
+	}
+	return "0x" + lower
+}
+
+func validatePgpKey(match []byte, submatch []byte) string {
+	if len(match) > maxPgpKeyLength {
+		return ""
+	}
+
+	key := strings.Replace(string(match), "\r", "", -1)
+	key = strings.Replace(key, "\x00", "", -1)
+	return key
+}
+
+func validatePgpFingerprint(match []byte, submatch []byte) string {
+	return strings.ToUpper(strings.Replace(string(submatch), " ", "", -1))
+}
+
+func validateHandle(match []byte, submatch []byte) string {
+	return strings.ToLower(string(submatch))
+}
+
+// Bestanden zoals logo@2x.png zijn geen e-mailadressen
+var emailFileExtensions = map[string]bool{"png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true, "webp": true, "css": true, "js": true}
+
+func validateEmail(match []byte, submatch []byte) string {
+	email := strings.ToLower(string(match))
+	tld := email[strings.LastIndex(email, ".")+1:]
+	if emailFileExtensions[tld] {
+		return ""
+	}
+	return email
+}
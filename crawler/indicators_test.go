@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"strings"
+	"testing"
+)
+
+func TestExtractIndicators(test *testing.T) {
+	text := strings.Join([]string{
+		"Betaal naar 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa of 3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy.",
+		"Ongeldig: 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb",
+		"Segwit: bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4 en BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+		"Taproot: bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+		"XMR: 44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A",
+		"ETH: 0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed, fout: 0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD",
+		"Mail ons op Info@Example.com, niet logo@2x.png",
+		"Jabber: dealer@jabber.example.org",
+		"Telegram: @darkshop_bot of t.me/darkshop_channel",
+		"Wickr me: shopowner99",
+		"Fingerprint: 4AEE 18F8 3AFD EB23 B5E6  1DC7 D2B5 F37C 5F6B 4D1E",
+		"-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQINBFoo\n=abcd\n-----END PGP PUBLIC KEY BLOCK-----",
+	}, "\n\x00")
+
+	expected := map[string]string{
+		queries.IndicatorBitcoin + " 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa":                                                             "",
+		queries.IndicatorBitcoin + " 3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy":                                                             "",
+		queries.IndicatorBitcoin + " bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4":                                                     "",
+		queries.IndicatorBitcoin + " bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0":                                 "",
+		queries.IndicatorMonero + " 44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A": "",
+		queries.IndicatorEthereum + " 0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed":                                                    "",
+		queries.IndicatorEmail + " info@example.com":                                                                                 "",
+		queries.IndicatorJabber + " dealer@jabber.example.org":                                                                       "",
+		queries.IndicatorTelegram + " darkshop_bot":                                                                                  "",
+		queries.IndicatorTelegram + " darkshop_channel":                                                                              "",
+		queries.IndicatorWickr + " shopowner99":                                                                                      "",
+		queries.IndicatorPgpFingerprint + " 4AEE18F83AFDEB23B5E61DC7D2B5F37C5F6B4D1E":                                                "",
+		queries.IndicatorPgpKey + " -----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQINBFoo\n=abcd\n-----END PGP PUBLIC KEY BLOCK-----":     "",
+	}
+
+	indicators := ExtractIndicators([]byte(text))
+	for _, indicator := range indicators {
+		key := indicator.Type + " " + indicator.Value
+		if _, found := expected[key]; !found {
+			test.Logf("Unexpected indicator %q", key)
+			test.Fail()
+			continue
+		}
+		delete(expected, key)
+
+		if indicator.Type == queries.IndicatorBitcoin && strings.HasPrefix(indicator.Value, "bc1q") && indicator.Occurrences != 2 {
+			test.Logf("Expected 2 occurrences of %v, got %v", indicator.Value, indicator.Occurrences)
+			test.Fail()
+		}
+
+		if indicator.Context == nil || strings.Contains(*indicator.Context, "\x00") {
+			test.Logf("Wrong context for %v", indicator.Value)
+			test.Fail()
+		}
+	}
+
+	for key := range expected {
+		test.Logf("Indicator %q not found", key)
+		test.Fail()
+	}
+}
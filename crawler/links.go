@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Waar in een document een link gevonden werd
+type LinkType int
+
+const (
+	LinkTypeUnknown LinkType = iota
+	LinkTypeAnchor
+	LinkTypeArea
+	LinkTypeFrame
+	LinkTypeIframe
+	LinkTypeForm
+
+	// <link rel="alternate"> (mirrors, feeds, vertalingen)
+	LinkTypeAlternate
+
+	// <meta http-equiv="refresh">
+	LinkTypeRefresh
+
+	// Toewijzing aan location in javascript
+	LinkTypeScript
+
+	// Url in platte tekst of een document
+	LinkTypeText
+
+	// Onion adres dat enkel in de zichtbare tekst vermeld wordt
+	LinkTypeMention
+
+	// Redirect naar een andere host
+	LinkTypeRedirect
+
+	// Start url van de crawler
+	LinkTypeSeed
+
+	// <link rel="canonical">, wordt niet gecrawld maar als alias bijgehouden
+	LinkTypeCanonical
+)
+
+var linkTypeNames = map[LinkType]string{
+	LinkTypeUnknown:   "unknown",
+	LinkTypeAnchor:    "anchor",
+	LinkTypeArea:      "area",
+	LinkTypeFrame:     "frame",
+	LinkTypeIframe:    "iframe",
+	LinkTypeForm:      "form",
+	LinkTypeAlternate: "alternate",
+	LinkTypeRefresh:   "refresh",
+	LinkTypeScript:    "script",
+	LinkTypeText:      "text",
+	LinkTypeMention:   "mention",
+	LinkTypeRedirect:  "redirect",
+	LinkTypeSeed:      "seed",
+	LinkTypeCanonical: "canonical",
+}
+
+func (t LinkType) String() string {
+	return linkTypeNames[t]
+}
+
+func LinkTypeFromString(name string) LinkType {
+	for linkType, n := range linkTypeNames {
+		if n == name {
+			return linkType
+		}
+	}
+	return LinkTypeUnknown
+}
+
+type FoundLink struct {
+	Url  *url.URL
+	Type LinkType
+
+	// Pagina waarop de link gevonden werd (leeg voor seeds)
+	Source string
+}
+
+// Attribuut met de link per tag
+var linkAttributes = map[string]struct {
+	attribute string
+	linkType  LinkType
+}{
+	"a":      {"href", LinkTypeAnchor},
+	"area":   {"href", LinkTypeArea},
+	"frame":  {"src", LinkTypeFrame},
+	"iframe": {"src", LinkTypeIframe},
+	"form":   {"action", LinkTypeForm},
+	"link":   {"href", LinkTypeAlternate},
+}
+
+// location = "...", location.href = '...', location.replace("...") en location.assign("...")
+var scriptLocationRegexp = regexp.MustCompile(`location(?:\.href)?\s*=\s*["']([^"'\s]+)["']|location\.(?:replace|assign)\(\s*["']([^"'\s]+)["']`)
+
+// Leest de attributen van de huidige tag in. Keys zijn lowercase, waarden worden gekopieerd.
+func readTagAttributes(z *html.Tokenizer) map[string]string {
+	attributes := make(map[string]string)
+	for {
+		key, val, moreAttr := z.TagAttr()
+		if key == nil {
+			break
+		}
+
+		if _, found := attributes[string(key)]; !found {
+			attributes[string(key)] = string(val)
+		}
+
+		if !moreAttr {
+			break
+		}
+	}
+	return attributes
+}
+
+// Zoekt de link in een start tag (a, area, frame, iframe, form, link en meta)
+func readTagLink(tagName string, z *html.Tokenizer) *FoundLink {
+	if tagName == "meta" {
+		attributes := readTagAttributes(z)
+		if strings.ToLower(strings.TrimSpace(attributes["http-equiv"])) != "refresh" {
+			return nil
+		}
+		return newFoundLink(parseRefreshContent(attributes["content"]), LinkTypeRefresh)
+	}
+
+	link, found := linkAttributes[tagName]
+	if !found {
+		return nil
+	}
+
+	attributes := readTagAttributes(z)
+	if tagName == "link" {
+		if hasRelation(attributes["rel"], "canonical") {
+			return newFoundLink([]byte(attributes["href"]), LinkTypeCanonical)
+		}
+
+		if !hasRelation(attributes["rel"], "alternate") {
+			// Stylesheets, icons...
+			return nil
+		}
+	}
+
+	value, found := attributes[link.attribute]
+	if !found {
+		return nil
+	}
+	return newFoundLink([]byte(value), link.linkType)
+}
+
+func newFoundLink(href []byte, linkType LinkType) *FoundLink {
+	if href == nil {
+		return nil
+	}
+
+	u := ParseUrlFromHref(href)
+	if u == nil {
+		return nil
+	}
+	return &FoundLink{Url: u, Type: linkType}
+}
+
+func hasRelation(rel string, relation string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, relation) {
+			return true
+		}
+	}
+	return false
+}
+
+// Haalt de url uit de content van een meta refresh: "5; url=http://..."
+func parseRefreshContent(content string) []byte {
+	index := strings.Index(content, ";")
+	if index == -1 {
+		index = strings.Index(content, ",")
+	}
+
+	if index == -1 {
+		return nil
+	}
+
+	value := strings.TrimSpace(content[index+1:])
+	if len(value) >= 4 && strings.EqualFold(value[:3], "url") {
+		rest := strings.TrimSpace(value[3:])
+		if strings.HasPrefix(rest, "=") {
+			value = strings.TrimSpace(rest[1:])
+		}
+	}
+
+	value = strings.Trim(value, `"'`)
+	if len(value) == 0 {
+		return nil
+	}
+	return []byte(value)
+}
+
+// Zoekt redirects in javascript
+func findScriptLinks(script []byte) []*FoundLink {
+	links := make([]*FoundLink, 0)
+	for _, match := range scriptLocationRegexp.FindAllSubmatch(script, -1) {
+		href := match[1]
+		if href == nil {
+			href = match[2]
+		}
+
+		// Javascript escapet soms slashes
+		href = bytes.Replace(href, []byte(`\/`), []byte("/"), -1)
+
+		if link := newFoundLink(href, LinkTypeScript); link != nil {
+			links = append(links, link)
+		}
+	}
+	return links
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadHtmlLinks(test *testing.T) {
+	page := `<html><head>
+<base href="http://mirror.onion/sub/"/>
+<meta http-equiv="Refresh" content="5; URL='/refreshed'">
+<link rel="stylesheet" href="/style.css">
+<link rel="canonical" href="/canonical-url">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml" />
+<script>if (x) { window.location.href = "/js-redirect"; } else { location.replace('http:\/\/other.onion\/'); }</script>
+</head><body>
+<a href="/anchor">Link</a>
+<map><area shape="rect" href="area.html"></map>
+<frameset><frame src="frame.html"></frameset>
+<iframe src="http://iframe.onion/"></iframe>
+<form action="/search" method="get"><input name="q"></form>
+<a name="geen-link">Tekst</a>
+</body></html>`
+
+	result := ReadHtml([]byte(page), true)
+
+	expected := []struct {
+		url      string
+		linkType LinkType
+	}{
+		{"/refreshed", LinkTypeRefresh},
+		{"/feed.xml", LinkTypeAlternate},
+		{"/js-redirect", LinkTypeScript},
+		{"http://other.onion/", LinkTypeScript},
+		{"/anchor", LinkTypeAnchor},
+		{"area.html", LinkTypeArea},
+		{"frame.html", LinkTypeFrame},
+		{"http://iframe.onion/", LinkTypeIframe},
+		{"/search", LinkTypeForm},
+	}
+
+	if len(result.Links) != len(expected) {
+		for _, link := range result.Links {
+			test.Logf("%v %v", link.Type, link.Url)
+		}
+		test.Fatalf("Expected %v links, got %v", len(expected), len(result.Links))
+	}
+
+	for i, e := range expected {
+		link := result.Links[i]
+		if link.Url.String() != e.url || link.Type != e.linkType {
+			test.Logf("Link %v: got %v (%v), expected %v (%v)", i, link.Url, link.Type, e.url, e.linkType)
+			test.Fail()
+		}
+	}
+
+	if result.Base == nil || result.Base.String() != "http://mirror.onion/sub/" {
+		test.Logf("Wrong base %v", result.Base)
+		test.Fail()
+	}
+
+	if result.Canonical == nil || result.Canonical.String() != "/canonical-url" {
+		test.Logf("Wrong canonical %v", result.Canonical)
+		test.Fail()
+	}
+
+	// Javascript hoort niet bij de doorzoekbare tekst
+	source := string(result.Lowercased)
+	if len(source) == 0 || strings.Contains(source, "js-redirect") {
+		test.Logf("Wrong searchable text %q", source)
+		test.Fail()
+	}
+}
+
+func TestParseRefreshContent(test *testing.T) {
+	cases := map[string]string{
+		"0;url=http://a.onion/":   "http://a.onion/",
+		"5; URL = '/page'":        "/page",
+		`3, url="relative.html"`:  "relative.html",
+		"10; http://b.onion/path": "http://b.onion/path",
+		"5":                       "",
+	}
+
+	for content, expected := range cases {
+		if result := string(parseRefreshContent(content)); result != expected {
+			test.Logf("%q parsed as %q, expected %q", content, result, expected)
+			test.Fail()
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Soort fout die optrad bij het uitvoeren van een request
+type NetworkError int
+
+const (
+	NetworkErrorUnknown NetworkError = iota
+
+	// De proxy zelf is onbereikbaar of weigert de request
+	NetworkErrorProxy
+
+	// De proxy of het netwerk meldt dat de host onbereikbaar is (bv. onion offline)
+	NetworkErrorUnreachable
+
+	// Request duurde te lang (volledige request of wachten op headers)
+	NetworkErrorTimeout
+
+	NetworkErrorDNS
+	NetworkErrorTLS
+	NetworkErrorConnectionReset
+	NetworkErrorConnectionRefused
+
+	// Server sloot de verbinding zonder (volledig) antwoord
+	NetworkErrorConnectionClosed
+
+	NetworkErrorTooManyRedirects
+
+	// Redirect naar een url op de blocklist
+	NetworkErrorRedirectBlocked
+
+	// Server gaf een HTTP antwoord op een HTTPS request
+	NetworkErrorHTTPResponseToHTTPS
+
+	// Request werd geannuleerd (crawler stopt)
+	NetworkErrorCanceled
+)
+
+var networkErrorNames = map[NetworkError]string{
+	NetworkErrorUnknown:             "unknown",
+	NetworkErrorProxy:               "proxy",
+	NetworkErrorUnreachable:         "unreachable",
+	NetworkErrorTimeout:             "timeout",
+	NetworkErrorDNS:                 "dns",
+	NetworkErrorTLS:                 "tls",
+	NetworkErrorConnectionReset:     "connection reset",
+	NetworkErrorConnectionRefused:   "connection refused",
+	NetworkErrorConnectionClosed:    "connection closed",
+	NetworkErrorTooManyRedirects:    "too many redirects",
+	NetworkErrorRedirectBlocked:     "redirect blocked",
+	NetworkErrorHTTPResponseToHTTPS: "http response to https",
+	NetworkErrorCanceled:            "canceled",
+}
+
+func (e NetworkError) String() string {
+	return networkErrorNames[e]
+}
+
+// Wat Hostworker.Request doet bij een bepaalde soort fout
+type networkErrorPolicy struct {
+	Ignore     bool // Item nooit meer opnieuw proberen
+	Retry      bool // Opnieuw proberen zonder de FailCount van het item te verhogen
+	HostFail   bool // Telt mee voor de FailCount van de host
+	StopWorker bool // Worker meteen laten stoppen
+	Timeout    bool // Telt als timeout (speedlogger en nieuw circuit)
+	UseHTTP    bool // Overschakelen naar http
+}
+
+var networkErrorPolicies = map[NetworkError]networkErrorPolicy{
+	NetworkErrorUnknown: {HostFail: true},
+
+	// Er is iets mis met de proxy, zal zich normaal automatisch herstellen
+	// maar we stoppen even met deze crawler. De host kan hier niets aan doen.
+	NetworkErrorProxy: {Retry: true, StopWorker: true},
+
+	NetworkErrorUnreachable:         {HostFail: true},
+	NetworkErrorTimeout:             {HostFail: true, Timeout: true},
+	NetworkErrorDNS:                 {HostFail: true},
+	NetworkErrorTLS:                 {HostFail: true},
+	NetworkErrorConnectionReset:     {HostFail: true},
+	NetworkErrorConnectionRefused:   {HostFail: true},
+	NetworkErrorConnectionClosed:    {HostFail: true},
+	NetworkErrorTooManyRedirects:    {Ignore: true},
+	NetworkErrorRedirectBlocked:     {Ignore: true},
+	NetworkErrorHTTPResponseToHTTPS: {HostFail: true, UseHTTP: true},
+
+	// Negeer failcount bij handmatige cancel
+	NetworkErrorCanceled: {Retry: true},
+}
+
+// Geen type beschikbaar in net/http voor deze fout
+const httpResponseToHTTPSMessage = "http: server gave HTTP response to HTTPS client"
+
+// Zet een fout van http.Client.Do om in een NetworkError
+func ClassifyNetworkError(err error) NetworkError {
+	if err == nil {
+		return NetworkErrorUnknown
+	}
+
+	chain := unwrapNetworkError(err)
+
+	// Fouten van de SOCKS proxy eerst, die verpakken zelf netwerkfouten
+	// van de verbinding met de proxy
+	for _, e := range chain {
+		if opErr, ok := e.(*net.OpError); ok && strings.HasPrefix(opErr.Op, "socks") {
+			return classifySocksError(opErr.Err)
+		}
+	}
+
+	// Van specifiek naar algemeen
+	for i := len(chain) - 1; i >= 0; i-- {
+		switch e := chain[i].(type) {
+		case *net.DNSError:
+			return NetworkErrorDNS
+		case syscall.Errno:
+			switch e {
+			case syscall.ECONNRESET, syscall.EPIPE, syscall.ECONNABORTED:
+				return NetworkErrorConnectionReset
+			case syscall.ECONNREFUSED:
+				return NetworkErrorConnectionRefused
+			case syscall.ETIMEDOUT:
+				return NetworkErrorTimeout
+			case syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+				return NetworkErrorUnreachable
+			}
+		case tls.RecordHeaderError, x509.UnknownAuthorityError, x509.CertificateInvalidError, x509.HostnameError:
+			return NetworkErrorTLS
+		}
+
+		switch chain[i] {
+		case context.Canceled:
+			return NetworkErrorCanceled
+		case context.DeadlineExceeded:
+			return NetworkErrorTimeout
+		case distributors.ErrTooManyRedirects:
+			return NetworkErrorTooManyRedirects
+		case distributors.ErrRedirectBlocked:
+			return NetworkErrorRedirectBlocked
+		case io.EOF, io.ErrUnexpectedEOF:
+			return NetworkErrorConnectionClosed
+		}
+	}
+
+	for _, e := range chain {
+		if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+			return NetworkErrorTimeout
+		}
+	}
+
+	message := chain[len(chain)-1].Error()
+	if message == httpResponseToHTTPSMessage {
+		return NetworkErrorHTTPResponseToHTTPS
+	}
+
+	// Alerts van crypto/tls hebben geen publiek type
+	if strings.HasPrefix(message, "tls: ") || strings.HasPrefix(message, "remote error: tls: ") {
+		return NetworkErrorTLS
+	}
+
+	// Oudere versies van x/net/proxy geven enkel tekstuele fouten terug
+	if strings.Contains(message, "SOCKS5") {
+		if isSocksTargetReply(message) {
+			return NetworkErrorUnreachable
+		}
+		return NetworkErrorProxy
+	}
+
+	return NetworkErrorUnknown
+}
+
+// Fout teruggegeven door de SOCKS proxy. Als de verbinding met de proxy mislukte
+// ligt het aan de proxy, anders meldt de proxy waarom de host niet bereikbaar is.
+func classifySocksError(err error) NetworkError {
+	for _, e := range unwrapNetworkError(err) {
+		switch e.(type) {
+		case syscall.Errno, *net.DNSError, *net.OpError:
+			return NetworkErrorProxy
+		}
+
+		if e == io.EOF || e == io.ErrUnexpectedEOF {
+			return NetworkErrorProxy
+		}
+	}
+
+	if isSocksTargetReply(err.Error()) {
+		return NetworkErrorUnreachable
+	}
+
+	// Authenticatie, protocol fouten of een verbinding die de proxy niet toelaat
+	return NetworkErrorProxy
+}
+
+// Antwoord codes uit RFC 1928 waarmee de proxy meldt dat de host zelf niet bereikbaar is.
+// Tor geeft "general SOCKS server failure" of "TTL expired" als een onion service offline is.
+var socksTargetReplies = []string{"general SOCKS server failure", "host unreachable", "network unreachable", "connection refused", "TTL expired"}
+
+func isSocksTargetReply(message string) bool {
+	for _, reply := range socksTargetReplies {
+		if strings.Contains(message, reply) {
+			return true
+		}
+	}
+	return false
+}
+
+// Geeft de fout en alle fouten die erin verpakt zitten terug, van buiten naar binnen
+func unwrapNetworkError(err error) []error {
+	chain := make([]error, 0, 4)
+	for err != nil && len(chain) < 16 {
+		chain = append(chain, err)
+
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case interface {
+			Unwrap() error
+		}:
+			err = e.Unwrap()
+		default:
+			err = nil
+		}
+	}
+	return chain
+}
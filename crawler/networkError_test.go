@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Transport die altijd dezelfde fout teruggeeft
+type fakeTransport struct {
+	err error
+}
+
+func (t *fakeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+func doRequest(client *http.Client, u string) error {
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err == nil {
+		response.Body.Close()
+	}
+	return err
+}
+
+func TestClassifyFakeTransport(test *testing.T) {
+	cases := []struct {
+		err      error
+		expected NetworkError
+	}{
+		{&net.DNSError{Err: "no such host", Name: "example.com"}, NetworkErrorDNS},
+		{&net.OpError{Op: "read", Net: "tcp", Err: &netSyscallError{syscall.ECONNRESET}}, NetworkErrorConnectionReset},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, NetworkErrorConnectionRefused},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("unknown error host unreachable")}, NetworkErrorUnreachable},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("unknown error TTL expired")}, NetworkErrorUnreachable},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("unknown error general SOCKS server failure")}, NetworkErrorUnreachable},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("unknown error connection not allowed by ruleset")}, NetworkErrorProxy},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("username/password authentication failed")}, NetworkErrorProxy},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, NetworkErrorProxy},
+		{errors.New("proxy: SOCKS5 proxy at 127.0.0.1:9150 failed to connect: host unreachable"), NetworkErrorUnreachable},
+		{errors.New("proxy: failed to read greeting from SOCKS5 proxy at 127.0.0.1:9150: EOF"), NetworkErrorProxy},
+		{errors.New("http: server gave HTTP response to HTTPS client"), NetworkErrorHTTPResponseToHTTPS},
+		{errors.New("remote error: tls: handshake failure"), NetworkErrorTLS},
+		{errors.New("something else"), NetworkErrorUnknown},
+	}
+
+	for _, c := range cases {
+		client := &http.Client{Transport: &fakeTransport{err: c.err}}
+		err := doRequest(client, "http://example.com/")
+
+		if kind := ClassifyNetworkError(err); kind != c.expected {
+			test.Logf("%v classified as %v, expected %v", err, kind, c.expected)
+			test.Fail()
+		}
+	}
+}
+
+type netSyscallError struct {
+	errno syscall.Errno
+}
+
+func (e *netSyscallError) Error() string {
+	return e.errno.Error()
+}
+
+func (e *netSyscallError) Unwrap() error {
+	return e.errno
+}
+
+func TestClassifyRealErrors(test *testing.T) {
+	// Verbinding geweigerd: luisteren en meteen sluiten zodat de poort vrij is
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if kind := ClassifyNetworkError(doRequest(client, "http://"+closedAddr+"/")); kind != NetworkErrorConnectionRefused {
+		test.Logf("Refused connection classified as %v", kind)
+		test.Fail()
+	}
+
+	// Server die nooit antwoordt
+	block := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer slow.Close()
+	defer close(block)
+
+	client = &http.Client{Timeout: 100 * time.Millisecond}
+	if kind := ClassifyNetworkError(doRequest(client, slow.URL)); kind != NetworkErrorTimeout {
+		test.Logf("Client timeout classified as %v", kind)
+		test.Fail()
+	}
+
+	client = &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 100 * time.Millisecond}}
+	if kind := ClassifyNetworkError(doRequest(client, slow.URL)); kind != NetworkErrorTimeout {
+		test.Logf("Header timeout classified as %v", kind)
+		test.Fail()
+	}
+
+	// Oneindige redirects
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	client = &http.Client{CheckRedirect: distributors.CheckRedirect}
+	if kind := ClassifyNetworkError(doRequest(client, redirect.URL)); kind != NetworkErrorTooManyRedirects {
+		test.Logf("Redirect loop classified as %v", kind)
+		test.Fail()
+	}
+
+	// HTTPS request naar een HTTP server
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	client = &http.Client{}
+	if kind := ClassifyNetworkError(doRequest(client, "https"+plain.URL[4:])); kind != NetworkErrorHTTPResponseToHTTPS {
+		test.Logf("HTTP response to HTTPS classified as %v", kind)
+		test.Fail()
+	}
+
+	// Ongeldig certificaat
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+
+	client = &http.Client{}
+	if kind := ClassifyNetworkError(doRequest(client, secure.URL)); kind != NetworkErrorTLS {
+		test.Logf("Invalid certificate classified as %v", kind)
+		test.Fail()
+	}
+
+	// Verbinding gesloten zonder antwoord
+	hangup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer hangup.Close()
+
+	client = &http.Client{}
+	if kind := ClassifyNetworkError(doRequest(client, hangup.URL)); kind != NetworkErrorConnectionClosed {
+		test.Logf("Closed connection classified as %v", kind)
+		test.Fail()
+	}
+
+	// Geannuleerde context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request, _ := http.NewRequest("GET", slow.URL, nil)
+	_, err = (&http.Client{}).Do(request.WithContext(ctx))
+	if kind := ClassifyNetworkError(err); kind != NetworkErrorCanceled {
+		test.Logf("Canceled request classified as %v", kind)
+		test.Fail()
+	}
+}
+
+func TestNetworkErrorPolicies(test *testing.T) {
+	for kind := NetworkErrorUnknown; kind <= NetworkErrorCanceled; kind++ {
+		if _, found := networkErrorPolicies[kind]; !found {
+			test.Logf("No policy for %v", kind)
+			test.Fail()
+		}
+
+		if len(kind.String()) == 0 {
+			test.Logf("No name for network error %v", int(kind))
+			test.Fail()
+		}
+	}
+
+	if !networkErrorPolicies[NetworkErrorProxy].StopWorker || networkErrorPolicies[NetworkErrorProxy].HostFail {
+		test.Log("Proxy errors should stop the worker without blaming the host")
+		test.Fail()
+	}
+
+	if !networkErrorPolicies[NetworkErrorUnreachable].HostFail || networkErrorPolicies[NetworkErrorUnreachable].Retry {
+		test.Log("Unreachable hosts should count as a host failure")
+		test.Fail()
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/base32"
+	"golang.org/x/crypto/sha3"
+	"net/url"
+	"regexp"
+)
+
+const (
+	onionV2Length = 16
+	onionV3Length = 56
+)
+
+// Scheiding tussen adres en "onion", ook in verdoezelde vormen zoals
+// "xyz[.]onion", "xyz (dot) onion" of "xyz . onion". De 0 bytes scheiden
+// tekst uit verschillende HTML elementen.
+var onionSuffixRegexp = regexp.MustCompile(`(?:[\s\x00]*(?:\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\}|\.)[\s\x00]*|\s+dot\s+)onion\b`)
+
+var onionBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567")
+
+func isOnionCharacter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '2' && c <= '7')
+}
+
+func isOnionSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '-' || c == 0
+}
+
+// Zoekt onion adressen in (lowercased) zichtbare tekst. Adressen die door spaties
+// opgesplitst zijn worden enkel aanvaard als v3 adres met geldige checksum.
+func findOnionMentions(text []byte) []*FoundLink {
+	links := make([]*FoundLink, 0)
+	found := make(map[string]bool)
+
+	for _, match := range onionSuffixRegexp.FindAllIndex(text, -1) {
+		address := onionAddressBefore(text, match[0])
+		if len(address) == 0 || found[address] {
+			continue
+		}
+		found[address] = true
+
+		links = append(links, &FoundLink{
+			Url:  &url.URL{Scheme: "http", Host: address + ".onion", Path: "/"},
+			Type: LinkTypeMention,
+		})
+	}
+	return links
+}
+
+// Leest het adres dat eindigt op positie end, achterwaarts in stukken gescheiden
+// door spaties of koppeltekens
+func onionAddressBefore(text []byte, end int) string {
+	address := make([]byte, 0, onionV3Length)
+	chunks := 0
+	v2 := ""
+
+	i := end - 1
+	for i >= 0 {
+		chunkEnd := i
+		for i >= 0 && isOnionCharacter(text[i]) {
+			i--
+		}
+
+		chunk := text[i+1 : chunkEnd+1]
+		if len(chunk) == 0 || len(address)+len(chunk) > onionV3Length {
+			break
+		}
+
+		address = append(append([]byte{}, chunk...), address...)
+		chunks++
+
+		if len(address) == onionV3Length {
+			if isValidOnionV3(address) {
+				return string(address)
+			}
+			break
+		}
+
+		if len(address) == onionV2Length && chunks == 1 {
+			v2 = string(address)
+		}
+
+		// Maximaal twee scheidingstekens tussen de stukken
+		separators := 0
+		for i >= 0 && separators < 2 && isOnionSeparator(text[i]) {
+			i--
+			separators++
+		}
+
+		if separators == 0 {
+			break
+		}
+	}
+
+	return v2
+}
+
+// Een v3 adres bevat de publieke sleutel, een checksum en de versie (3)
+func isValidOnionV3(address []byte) bool {
+	if len(address) != onionV3Length {
+		return false
+	}
+
+	decoded, err := onionBase32.DecodeString(string(address))
+	if err != nil || len(decoded) != 35 || decoded[34] != 3 {
+		return false
+	}
+
+	publicKey := decoded[:32]
+	checksum := sha3.Sum256(append(append([]byte(".onion checksum"), publicKey...), 3))
+	return bytes.Equal(checksum[:2], decoded[32:34])
+}
+
+// Host label van een geldig v2 of v3 adres
+func isValidOnionDomain(domain string) bool {
+	if len(domain) == onionV2Length {
+		return true
+	}
+	return len(domain) == onionV3Length && isValidOnionV3(bytes.ToLower([]byte(domain)))
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testOnionV3 = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad"
+
+func TestFindOnionMentions(test *testing.T) {
+	split := testOnionV3[:20] + " " + testOnionV3[20:40] + " " + testOnionV3[40:]
+	invalid := strings.Replace(testOnionV3, "duck", "duct", 1)
+
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{"nieuwe mirror: " + testOnionV3 + ".onion!", []string{testOnionV3}},
+		{"mirror op " + testOnionV3 + "[.]onion en expyuzz4wqqyqhjn(dot)onion", []string{testOnionV3, "expyuzz4wqqyqhjn"}},
+		{"gesplitst: " + split + " . onion", []string{testOnionV3}},
+		{"zie http://expyuzz4wqqyqhjn.onion/pad en expyuzz4wqqyqhjn.onion", []string{"expyuzz4wqqyqhjn"}},
+		{"subdomein www." + testOnionV3 + ".onion", []string{testOnionV3}},
+		{"ongeldige checksum " + invalid + ".onion", []string{}},
+		{"te kort abcdef.onion en onionxyz", []string{}},
+		{"gesplitst v2 expyuzz4 wqqyqhjn.onion", []string{}},
+	}
+
+	for _, c := range cases {
+		links := findOnionMentions([]byte(c.text))
+
+		found := make([]string, 0, len(links))
+		for _, link := range links {
+			if link.Type != LinkTypeMention || link.Url.Path != "/" {
+				test.Logf("Wrong link %v (%v)", link.Url, link.Type)
+				test.Fail()
+			}
+			found = append(found, strings.TrimSuffix(link.Url.Host, ".onion"))
+		}
+
+		if strings.Join(found, ",") != strings.Join(c.expected, ",") {
+			test.Logf("%q: found %v, expected %v", c.text, found, c.expected)
+			test.Fail()
+		}
+	}
+}
+
+func TestOnionMentionsInHtml(test *testing.T) {
+	page := []byte("<html><body><p>Nieuw adres: <b>" + strings.ToUpper(testOnionV3) + "</b>.onion</p></body></html>")
+
+	result, err := Parse(bytes.NewReader(page), ReadHtml, nil, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(result.Links) != 1 || result.Links[0].Url.String() != "http://"+testOnionV3+".onion/" {
+		test.Logf("Wrong links %v", result.Links)
+		test.Fail()
+	}
+
+	if !isValidOnionDomain(strings.ToUpper(testOnionV3)) || isValidOnionDomain(testOnionV3[1:]) {
+		test.Log("Wrong onion domain validation")
+		test.Fail()
+	}
+}
@@ -0,0 +1,238 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Langste Retry-After die we respecteren
+const maxRetryAfter = 24 * time.Hour
+
+// Na zoveel 429/503 antwoorden na elkaar volgt een failstreak voor de host
+const maxThrottleStreak = 5
+
+// Aanpassing van de snelheid per request: trage antwoorden of fouten
+// verlagen de snelheid meteen, succesvolle requests verhogen die langzaam
+const rateIncrease = 0.02
+const rateSlowdown = 0.8
+const rateFailure = 0.75
+const rateThrottle = 0.5
+
+// Een antwoord is traag als het zoveel keer langer duurt dan gemiddeld
+const slowLatencyFactor = 2.5
+
+// Token bucket per host. Enkel gebruikt vanuit de goroutine van de worker,
+// Ready wordt ook door de crawler opgevraagd als de worker niet loopt.
+type HostLimiter struct {
+	Rate    float64 // requests per seconde
+	MinRate float64
+	MaxRate float64
+	Burst   float64
+
+	tokens float64
+	last   time.Time
+
+	// Retry-After: tot dan geen requests meer
+	NotBefore time.Time
+
+	// Voortschrijdend gemiddelde van de tijd tot de headers binnen zijn
+	Latency time.Duration
+
+	// Aantal keer 429/503 ontvangen sinds de vorige statistieken
+	Throttled int
+}
+
+// Met rate 0 is er geen limiet, enkel Retry-After wordt dan nog gerespecteerd
+func NewHostLimiter(rate, minRate, maxRate float64, burst int) *HostLimiter {
+	if rate <= 0 {
+		return &HostLimiter{}
+	}
+	if minRate <= 0 {
+		minRate = 0.01
+	}
+	if maxRate < minRate {
+		maxRate = minRate
+	}
+	if rate < minRate {
+		rate = minRate
+	}
+	if rate > maxRate {
+		rate = maxRate
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &HostLimiter{Rate: rate, MinRate: minRate, MaxRate: maxRate, Burst: float64(burst), tokens: float64(burst)}
+}
+
+// Of de host geen Retry-After meer heeft lopen
+func (l *HostLimiter) Ready(now time.Time) bool {
+	return !now.Before(l.NotBefore)
+}
+
+// Neemt een token en geeft terug hoe lang we moeten wachten voor de request mag starten
+func (l *HostLimiter) Take(now time.Time) time.Duration {
+	if l.Rate <= 0 {
+		return l.NotBefore.Sub(now)
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.Rate
+		if l.tokens > l.Burst {
+			l.tokens = l.Burst
+		}
+	}
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.Rate * float64(time.Second))
+	}
+	if retry := l.NotBefore.Sub(now); retry > wait {
+		wait = retry
+	}
+	return wait
+}
+
+// Gemiddelde tijd tussen twee requests
+func (l *HostLimiter) Interval() time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Request gelukt: sneller gaan, tenzij de server trager begint te antwoorden
+func (l *HostLimiter) Success(latency time.Duration) {
+	if l.Latency == 0 {
+		l.Latency = latency
+	}
+
+	if float64(latency) > float64(l.Latency)*slowLatencyFactor {
+		l.setRate(l.Rate * rateSlowdown)
+	} else {
+		l.setRate(l.Rate + rateIncrease)
+	}
+	l.Latency = (l.Latency*7 + latency) / 8
+}
+
+// Timeout of serverfout
+func (l *HostLimiter) Failure() {
+	l.setRate(l.Rate * rateFailure)
+}
+
+// 429 of 503: veel trager gaan en Retry-After respecteren
+func (l *HostLimiter) Throttle(now time.Time, retryAfter time.Duration) {
+	l.Throttled++
+	l.setRate(l.Rate * rateThrottle)
+
+	if retryAfter > maxRetryAfter {
+		retryAfter = maxRetryAfter
+	}
+	if retryAfter > 0 {
+		l.NotBefore = now.Add(retryAfter)
+	}
+}
+
+// Geen requests voor until, een langere wachttijd blijft behouden
+func (l *HostLimiter) Pause(until time.Time) {
+	if until.After(l.NotBefore) {
+		l.NotBefore = until
+	}
+}
+
+func (l *HostLimiter) setRate(rate float64) {
+	if l.Rate <= 0 {
+		return
+	}
+	if rate < l.MinRate {
+		rate = l.MinRate
+	}
+	if rate > l.MaxRate {
+		rate = l.MaxRate
+	}
+	l.Rate = rate
+}
+
+// Retry-After header: aantal seconden of een HTTP datum
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// Gedeelde limiet op de totale downloadsnelheid van alle workers
+type BandwidthLimiter struct {
+	lock   sync.Mutex
+	rate   float64 // bytes per seconde, 0 = onbeperkt
+	tokens float64
+	last   time.Time
+}
+
+func NewBandwidthLimiter(bytesPerSecond int) *BandwidthLimiter {
+	return &BandwidthLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond)}
+}
+
+// Neemt n bytes en geeft terug hoe lang de lezer moet wachten
+func (b *BandwidthLimiter) Take(n int, now time.Time) time.Duration {
+	if b == nil || b.rate <= 0 {
+		return 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			// Maximaal één seconde opsparen
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Reader die na elke Read wacht tot de gelezen bytes binnen de limiet vallen
+func (b *BandwidthLimiter) Reader(reader io.Reader) io.Reader {
+	if b == nil || b.rate <= 0 {
+		return reader
+	}
+	return &bandwidthReader{Reader: reader, limiter: b}
+}
+
+type bandwidthReader struct {
+	Reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (r *bandwidthReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	if n > 0 {
+		if wait := r.limiter.Take(n, time.Now()); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	return n, err
+}
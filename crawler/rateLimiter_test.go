@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(test *testing.T) {
+	limiter := NewHostLimiter(1, 0.5, 2, 2)
+	now := time.Now()
+
+	// Burst van 2 requests, daarna 1 per seconde
+	for i := 0; i < 2; i++ {
+		if wait := limiter.Take(now); wait != 0 {
+			test.Logf("Request %v within burst had to wait %v", i, wait)
+			test.Fail()
+		}
+	}
+	if wait := limiter.Take(now); wait != time.Second {
+		test.Logf("Expected to wait 1s, got %v", wait)
+		test.Fail()
+	}
+
+	// Succes verhoogt de snelheid tot het maximum
+	for i := 0; i < 100; i++ {
+		limiter.Success(100 * time.Millisecond)
+	}
+	if limiter.Rate != 2 {
+		test.Logf("Rate should reach maximum, got %v", limiter.Rate)
+		test.Fail()
+	}
+
+	// Een veel trager antwoord verlaagt de snelheid
+	limiter.Success(time.Second)
+	if limiter.Rate >= 2 {
+		test.Log("Slow response should decrease rate")
+		test.Fail()
+	}
+
+	// 429 met Retry-After
+	limiter.Throttle(now, parseRetryAfter("120", now))
+	if limiter.Ready(now.Add(time.Minute)) || !limiter.Ready(now.Add(121*time.Second)) {
+		test.Log("Retry-After not respected")
+		test.Fail()
+	}
+	if limiter.Rate < 0.5 || limiter.Rate > 1 || limiter.Throttled != 1 {
+		test.Logf("Wrong rate after throttle: %v", limiter.Rate)
+		test.Fail()
+	}
+
+	for i := 0; i < 10; i++ {
+		limiter.Failure()
+	}
+	if limiter.Rate != 0.5 {
+		test.Logf("Rate should not drop below minimum, got %v", limiter.Rate)
+		test.Fail()
+	}
+
+	date := now.Add(time.Hour).UTC().Format(http.TimeFormat)
+	if retry := parseRetryAfter(date, now); retry < 59*time.Minute || retry > time.Hour {
+		test.Logf("Wrong Retry-After for http date: %v", retry)
+		test.Fail()
+	}
+
+	// Zonder snelheid geen limiet
+	unlimited := NewHostLimiter(0, 0, 0, 0)
+	if unlimited.Take(now) > 0 || unlimited.Take(now) > 0 {
+		test.Log("Unlimited limiter should not wait")
+		test.Fail()
+	}
+}
+
+func TestBandwidthLimiter(test *testing.T) {
+	limiter := NewBandwidthLimiter(1000)
+	now := time.Now()
+
+	if wait := limiter.Take(1000, now); wait != 0 {
+		test.Logf("First second should not wait, got %v", wait)
+		test.Fail()
+	}
+	if wait := limiter.Take(500, now); wait != 500*time.Millisecond {
+		test.Logf("Expected to wait 500ms, got %v", wait)
+		test.Fail()
+	}
+	if wait := limiter.Take(500, now.Add(time.Second)); wait != 0 {
+		test.Logf("Should not wait after refill, got %v", wait)
+		test.Fail()
+	}
+
+	var unlimited *BandwidthLimiter
+	if unlimited.Take(1000000, now) != 0 {
+		test.Log("Nil limiter should not wait")
+		test.Fail()
+	}
+}
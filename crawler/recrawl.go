@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"time"
+)
+
+// Aanpassing van het recrawl interval van een pagina na elk bezoek
+const changeIntervalChanged = 0.5
+const changeIntervalUnchanged = 1.5
+
+// Een pagina mag iets vroeger dan gepland opnieuw bezocht worden, anders
+// schuift ze telkens een volledige cycle op
+const recrawlTolerance = 0.9
+
+// Interval tussen twee recrawls van een host als we nog niets over de pagina's weten
+func (cfg *CrawlerConfig) BaseRecrawlInterval() time.Duration {
+	if cfg.RecrawlInterval <= 0 {
+		return 12 * time.Hour
+	}
+	return time.Duration(cfg.RecrawlInterval) * time.Minute
+}
+
+// Zonder maximum interval wordt elke pagina elke cycle opnieuw bezocht
+func (cfg *CrawlerConfig) AdaptiveRecrawl() bool {
+	return cfg.RecrawlMaxInterval > 0
+}
+
+// Geschat interval tussen twee wijzigingen van deze pagina
+func (i *CrawlItem) RecrawlInterval(base time.Duration) time.Duration {
+	if i.ChangeInterval > 0 {
+		return i.ChangeInterval
+	}
+	return base
+}
+
+// Tijdstip waarop deze pagina opnieuw bezocht moet worden
+func (i *CrawlItem) NextRecrawl(base time.Duration) *time.Time {
+	if i.LastDownload == nil {
+		return nil
+	}
+	next := i.LastDownload.Add(i.RecrawlInterval(base))
+	return &next
+}
+
+// Past het geschatte wijzigingsinterval aan na een download. Een gewijzigde
+// pagina komt sneller terug, een ongewijzigde (zelfde hash of 304) trager.
+// Oproepen voor RequestFinished, LastDownload is dan nog die van het vorige bezoek
+func (w *Hostworker) UpdateChangeInterval(item *CrawlItem, changed bool) {
+	cfg := w.crawler.cfg
+	if !cfg.AdaptiveRecrawl() {
+		return
+	}
+
+	if item.LastDownload == nil || item.ChangeInterval == 0 {
+		// Eerste download: nog niets geweten over de wijzigingen
+		item.ChangeInterval = cfg.BaseRecrawlInterval()
+	} else if changed {
+		w.ChangedPages++
+		item.ChangeInterval = time.Duration(float64(item.ChangeInterval) * changeIntervalChanged)
+	} else {
+		item.ChangeInterval = time.Duration(float64(item.ChangeInterval) * changeIntervalUnchanged)
+	}
+
+	min := time.Duration(cfg.RecrawlMinInterval) * time.Minute
+	max := time.Duration(cfg.RecrawlMaxInterval) * time.Minute
+	if item.ChangeInterval < min {
+		item.ChangeInterval = min
+	}
+	if item.ChangeInterval > max {
+		item.ChangeInterval = max
+	}
+
+	if item.Depth < maxRecrawlDepth {
+		w.noteRecrawl(time.Now().Add(item.ChangeInterval))
+	}
+}
+
+// Of een pagina die in een nieuwe cycle gevonden wordt al opnieuw bezocht moet worden.
+// Zo niet, dan onthouden we wanneer wel zodat de volgende cycle op tijd start
+func (w *Hostworker) RecrawlDue(item *CrawlItem) bool {
+	if !w.crawler.cfg.AdaptiveRecrawl() || item.LastDownload == nil || item.ChangeInterval == 0 {
+		return true
+	}
+
+	if time.Since(*item.LastDownload) >= time.Duration(float64(item.ChangeInterval)*recrawlTolerance) {
+		return true
+	}
+
+	w.RecrawlSkipped++
+	if item.Depth < maxRecrawlDepth {
+		w.noteRecrawl(item.LastDownload.Add(item.ChangeInterval))
+	}
+	return false
+}
+
+// Houdt het vroegste tijdstip bij waarop een pagina van deze host opnieuw moet
+func (w *Hostworker) noteRecrawl(next time.Time) {
+	if w.nextRecrawl == nil || next.Before(*w.nextRecrawl) {
+		w.nextRecrawl = &next
+	}
+}
+
+// Tijdstip van de volgende recrawl cycle van deze host: de vroegste van alle
+// introduction points en de pagina's die tijdens de vorige cycle bezocht werden
+func (w *Hostworker) NextRecrawl() *time.Time {
+	base := w.crawler.cfg.BaseRecrawlInterval()
+	next := w.nextRecrawl
+
+	for item := w.IntroductionPoints.First; item != nil; item = item.Next {
+		if t := item.NextRecrawl(base); t != nil && (next == nil || t.Before(*next)) {
+			next = t
+		}
+	}
+	return next
+}
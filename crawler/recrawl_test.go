@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestChangeInterval(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, RecrawlInterval: 60, RecrawlMinInterval: 30, RecrawlMaxInterval: 240})
+	worker := NewHostworker("test.com", crawler)
+
+	start, _ := url.Parse("http://www.test.com/")
+	item, _ := worker.NewReference(start, nil, false)
+	item.Remove()
+
+	// Eerste download: startinterval
+	worker.UpdateChangeInterval(item, true)
+	worker.RequestFinished(item)
+	if item.ChangeInterval != time.Hour || worker.ChangedPages != 0 {
+		test.Logf("Wrong initial interval %v", item.ChangeInterval)
+		test.Fail()
+	}
+
+	// Ongewijzigd: trager tot het maximum
+	expected := []time.Duration{90 * time.Minute, 135 * time.Minute, 202*time.Minute + 30*time.Second, 240 * time.Minute}
+	for _, interval := range expected {
+		worker.UpdateChangeInterval(item, false)
+		if item.ChangeInterval != interval {
+			test.Logf("Expected interval %v, got %v", interval, item.ChangeInterval)
+			test.Fail()
+		}
+	}
+
+	// Gewijzigd: sneller tot het minimum
+	for i := 0; i < 5; i++ {
+		worker.UpdateChangeInterval(item, true)
+	}
+	if item.ChangeInterval != 30*time.Minute || worker.ChangedPages != 5 {
+		test.Logf("Expected minimum interval, got %v", item.ChangeInterval)
+		test.Fail()
+	}
+
+	// Net gedownload: nog niet opnieuw, wel de volgende recrawl van de host vervroegen
+	if worker.RecrawlDue(item) || worker.RecrawlSkipped != 1 {
+		test.Log("Page should not be due yet")
+		test.Fail()
+	}
+	if duration := worker.GetRecrawlDuration(); duration > 30*time.Minute || duration < 29*time.Minute {
+		test.Logf("Host recrawl should follow the page interval, got %v", duration)
+		test.Fail()
+	}
+
+	earlier := time.Now().Add(-28 * time.Minute)
+	item.LastDownload = &earlier
+	if !worker.RecrawlDue(item) {
+		test.Log("Page should be due")
+		test.Fail()
+	}
+
+	// Interval blijft bewaard, oude bestanden zonder extra kolommen blijven leesbaar
+	str := item.SaveToString()
+	loaded := NewCrawlItemFromString(&str, nil)
+	if loaded == nil || loaded.ChangeInterval != item.ChangeInterval {
+		test.Logf("Change interval lost after saving: %v", str)
+		test.Fail()
+	}
+
+	old := "/page	1	0	false	0			0"
+	if loaded := NewCrawlItemFromString(&old, nil); loaded == nil || loaded.ChangeInterval != 0 || !worker.RecrawlDue(loaded) {
+		test.Log("Old crawl item format not readable")
+		test.Fail()
+	}
+
+	// Zonder maximum: elke cycle alles opnieuw
+	fixed := NewHostworker("test.com", NewCrawler(&CrawlerConfig{Testing: true}))
+	if !fixed.RecrawlDue(item) {
+		test.Log("Every page should be due without adaptive recrawl")
+		test.Fail()
+	}
+}
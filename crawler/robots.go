@@ -0,0 +1,343 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximale grootte van een robots.txt bestand, de rest wordt genegeerd
+const maxRobotsSize = 500 * 1024
+
+// Hoe lang een robots.txt bewaard wordt, en hoe lang we wachten als die onbereikbaar was
+const robotsCacheTime = 24 * time.Hour
+const robotsRetryTime = 30 * time.Minute
+
+// Na zoveel keer na elkaar een onbereikbare robots.txt telt elke request als fout van de host
+const maxRobotsFailures = 3
+
+// Langer dan dit wachten we niet binnen een request op de crawl-delay,
+// de worker gaat dan slapen
+const maxCrawlDelayWait = 10 * time.Second
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// Regels uit robots.txt die gelden voor onze user agent
+type Robots struct {
+	rules      []robotsRule
+	CrawlDelay time.Duration
+
+	// robots.txt kon niet opgehaald worden (5xx, netwerkfout): voorlopig niets crawlen
+	Unavailable bool
+
+	// Sitemap regels, gelden los van de groepen
+	Sitemaps []string
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// Leest robots.txt en houdt enkel de groepen over die van toepassing zijn op agent.
+// Als geen enkele groep agent vermeldt, gelden de groepen voor "*".
+func ParseRobots(data []byte, agent string) *Robots {
+	agent = strings.ToLower(agent)
+	groups := make([]*robotsGroup, 0)
+	var group *robotsGroup
+	lastWasAgent := false
+	sitemaps := make([]string, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index != -1 {
+			line = line[:index]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			// Opeenvolgende user-agent regels horen bij dezelfde groep
+			if !lastWasAgent || group == nil {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+
+		case "allow", "disallow":
+			if group != nil && value != "" {
+				group.rules = append(group.rules, robotsRule{pattern: value, allow: key == "allow"})
+			}
+
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+
+		case "crawl-delay":
+			if group != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					group.delay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	robots := &Robots{Sitemaps: sitemaps}
+	if !robots.addGroups(groups, func(name string) bool { return name != "*" && name != "" && strings.Contains(agent, name) }) {
+		robots.addGroups(groups, func(name string) bool { return name == "*" })
+	}
+	return robots
+}
+
+func (robots *Robots) addGroups(groups []*robotsGroup, matches func(name string) bool) bool {
+	found := false
+	for _, group := range groups {
+		for _, name := range group.agents {
+			if matches(name) {
+				found = true
+				robots.rules = append(robots.rules, group.rules...)
+				if group.delay > robots.CrawlDelay {
+					robots.CrawlDelay = group.delay
+				}
+				break
+			}
+		}
+	}
+	return found
+}
+
+// Of een url gecrawld mag worden. De langste regel die past wint, bij gelijke lengte Allow.
+func (robots *Robots) Allowed(u *url.URL) bool {
+	if robots.Unavailable {
+		return false
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed := true
+	length := -1
+	for _, rule := range robots.rules {
+		if len(rule.pattern) < length || (len(rule.pattern) == length && !rule.allow) {
+			continue
+		}
+		if robotsPatternMatches(rule.pattern, path) {
+			allowed = rule.allow
+			length = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// Patronen beginnen vooraan in het pad, * past op alles en $ op het einde
+func robotsPatternMatches(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	position := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && anchored {
+			// Laatste stuk moet op het einde staan
+			return len(path)-position >= len(parts[i]) && strings.HasSuffix(path, parts[i])
+		}
+
+		index := strings.Index(path[position:], parts[i])
+		if index == -1 {
+			return false
+		}
+		position += index + len(parts[i])
+	}
+
+	return !anchored || position == len(path)
+}
+
+// Of robots.txt gerespecteerd moet worden voor deze host
+func (w *Hostworker) RespectsRobots(subdomain *Subdomain) bool {
+	if !w.crawler.cfg.RespectRobots {
+		return false
+	}
+	for _, host := range w.crawler.cfg.RobotsOverride {
+		if host == w.Host || host == subdomain.Url.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// Haalt robots.txt van een subdomein op als die nog niet (of te lang geleden) opgehaald werd.
+// Het ophalen gebeurt zonder w.lock, andere goroutines wachten tot het klaar is.
+func (w *Hostworker) RobotsFor(subdomain *Subdomain) *Robots {
+	for subdomain.robotsFetch != nil {
+		done := subdomain.robotsFetch
+		w.unlocked(func() {
+			<-done
+		})
+	}
+
+	if subdomain.Robots != nil && time.Now().Before(subdomain.RobotsExpires) {
+		return subdomain.Robots
+	}
+
+	robotsUrl := &url.URL{Scheme: subdomain.Url.Scheme, Host: subdomain.Url.Host, Path: "/robots.txt"}
+	if robotsUrl.Scheme == "" {
+		robotsUrl.Scheme = w.Scheme
+	}
+
+	done := make(chan struct{})
+	subdomain.robotsFetch = done
+	defer func() {
+		subdomain.robotsFetch = nil
+		close(done)
+	}()
+
+	var robots *Robots
+	w.unlocked(func() {
+		robots = w.fetchRobots(robotsUrl)
+	})
+	subdomain.Robots = robots
+	if robots.Unavailable {
+		subdomain.RobotsFailures++
+		subdomain.RobotsExpires = time.Now().Add(robotsRetryTime)
+	} else {
+		subdomain.RobotsFailures = 0
+		subdomain.RobotsExpires = time.Now().Add(robotsCacheTime)
+	}
+	return robots
+}
+
+// Wordt uitgevoerd zonder w.lock
+func (w *Hostworker) fetchRobots(robotsUrl *url.URL) *Robots {
+	request, err := http.NewRequest("GET", robotsUrl.String(), nil)
+	if err != nil {
+		return &Robots{Unavailable: true}
+	}
+	request.Header.Add("User-Agent", w.crawler.cfg.UserAgent)
+	request = request.WithContext(distributors.WithRedirectFilter(w.crawler.context, func(u *url.URL) bool {
+		return !w.crawler.Blocklist.BlocksUrl(u)
+	}))
+
+	response, err := w.Client.Do(request)
+	if err != nil {
+		if ClassifyNetworkError(err) == NetworkErrorRedirectBlocked {
+			// Zelfde als een robots.txt die niet bestaat
+			return &Robots{}
+		}
+		if w.crawler.cfg.LogNetwork {
+			w.crawler.cfg.Log("robots", err.Error())
+		}
+		return &Robots{Unavailable: true}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxRobotsSize))
+		if err != nil {
+			return &Robots{Unavailable: true}
+		}
+		return ParseRobots(data, w.crawler.cfg.RobotsAgent)
+	}
+
+	if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != 429 {
+		// Geen robots.txt: alles toegelaten
+		return &Robots{}
+	}
+	return &Robots{Unavailable: true}
+}
+
+// Controleert robots.txt en wacht de crawl-delay af. Geeft false terug als het item
+// niet gedownload mag worden, het item is dan al afgehandeld.
+func (w *Hostworker) CheckRobots(item *CrawlItem) bool {
+	subdomain := item.Subdomain
+	if !w.RespectsRobots(subdomain) {
+		return true
+	}
+
+	robots := w.RobotsFor(subdomain)
+	if robots.Unavailable {
+		if subdomain.RobotsFailures < maxRobotsFailures {
+			// Later opnieuw proberen zonder dat het item faalt. De host wacht
+			// tot robots.txt opnieuw opgehaald mag worden
+			item.FailCount--
+			w.Limiter.Pause(subdomain.RobotsExpires)
+		} else {
+			// Blijft onbereikbaar: de host is waarschijnlijk offline
+			w.HostFailed(item)
+		}
+		w.RequestFailed(item)
+		w.sleepAfter = -1
+		return false
+	}
+
+	if !robots.Allowed(item.URL) {
+		if w.crawler.cfg.LogRequests {
+			w.crawler.cfg.LogInfo("Disallowed by robots.txt " + item.String())
+		}
+		w.RequestIgnored(item)
+		return false
+	}
+
+	if robots.CrawlDelay > 0 {
+		now := time.Now()
+		wait := subdomain.LastRequest.Add(robots.CrawlDelay).Sub(now)
+		if wait > maxCrawlDelayWait {
+			// Niet zo lang blijven wachten, de worker gaat slapen tot de crawl-delay voorbij is
+			item.FailCount--
+			w.Limiter.Pause(subdomain.LastRequest.Add(robots.CrawlDelay))
+			w.RequestFailed(item)
+			w.sleepAfter = -1
+			return false
+		}
+		if wait > 0 {
+			// Tijdstip al vastleggen zodat andere goroutines na deze request wachten
+			subdomain.LastRequest = now.Add(wait)
+			w.unlocked(func() {
+				time.Sleep(wait)
+			})
+		}
+
+		// Een worker blijft niet veel langer bezet dan zonder crawl-delay
+		interval := w.Limiter.Interval()
+		if interval > 0 && robots.CrawlDelay > interval {
+			w.sleepAfter -= int(robots.CrawlDelay/interval) - 1
+		}
+	}
+	subdomain.LastRequest = time.Now()
+	return true
+}
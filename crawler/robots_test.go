@@ -0,0 +1,218 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(test *testing.T) {
+	data := []byte(`# Voorbeeld
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+
+User-agent: Googlebot
+User-agent: LanternCrawler
+Disallow: /cart
+Disallow: /*.pdf$
+Disallow: /search?
+Allow: /cart/public
+Allow: /shop/*/info$
+Disallow: /shop/
+Crawl-delay: 1.5
+
+User-agent: Other
+Disallow: /
+`)
+
+	robots := ParseRobots(data, "LanternCrawler/1.0")
+	if robots.CrawlDelay != 1500*time.Millisecond {
+		test.Logf("Wrong crawl delay %v", robots.CrawlDelay)
+		test.Fail()
+	}
+
+	tests := map[string]bool{
+		"":                     true,
+		"/":                    true,
+		"/private/page":        true,
+		"/cart":                false,
+		"/cart/checkout":       false,
+		"/cart/public/x":       true,
+		"/files/a.pdf":         false,
+		"/files/a.pdf?x=1":     true,
+		"/search?q=test":       false,
+		"/search":              true,
+		"/shop/item":           false,
+		"/shop/item/info":      true,
+		"/shop/item/info/more": false,
+		"/robots.txt":          true,
+	}
+
+	for str, expected := range tests {
+		u, _ := url.Parse(str)
+		if robots.Allowed(u) != expected {
+			test.Logf("Allowed(%v) should be %v", str, expected)
+			test.Fail()
+		}
+	}
+
+	// Zonder eigen groep gelden de regels voor *
+	robots = ParseRobots(data, "SomethingElse")
+	u, _ := url.Parse("/private/page")
+	if robots.Allowed(u) || robots.CrawlDelay != 2*time.Second {
+		test.Log("Wildcard group not applied")
+		test.Fail()
+	}
+
+	u, _ = url.Parse("/cart")
+	if !robots.Allowed(u) {
+		test.Log("Rules of other group applied")
+		test.Fail()
+	}
+
+	if (&Robots{Unavailable: true}).Allowed(u) {
+		test.Log("Unavailable robots.txt should disallow everything")
+		test.Fail()
+	}
+}
+
+func TestRobotsUnavailable(test *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, RespectRobots: true})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+
+	worker.NewReference(serverUrl, nil, false)
+	subdomain := worker.Subdomains[serverUrl.Host]
+
+	for i := 1; i <= maxRobotsFailures; i++ {
+		item := &CrawlItem{URL: &url.URL{Path: "/"}, Subdomain: subdomain}
+		subdomain.RobotsExpires = time.Time{}
+
+		worker.lock.Lock()
+		allowed := worker.CheckRobots(item)
+		worker.lock.Unlock()
+
+		if allowed || subdomain.RobotsFailures != i {
+			test.Logf("Unavailable robots.txt allowed or not counted (%v failures)", subdomain.RobotsFailures)
+			test.Fail()
+		}
+
+		// Enkel de laatste keer telt als fout van de host en het item
+		expected := 0
+		if i == maxRobotsFailures {
+			expected = 1
+		}
+		if worker.FailCount != expected || item.FailCount != expected {
+			test.Logf("Attempt %v: host fail count %v, item fail count %v", i, worker.FailCount, item.FailCount)
+			test.Fail()
+		}
+
+		// Geen busy loop: de host wacht tot robots.txt opnieuw opgehaald mag worden
+		if i < maxRobotsFailures && !worker.ParkedUntil(time.Now()).Equal(subdomain.RobotsExpires) {
+			test.Logf("Attempt %v: host not parked until %v", i, subdomain.RobotsExpires)
+			test.Fail()
+		}
+	}
+}
+
+func TestRobotsLongCrawlDelay(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, RespectRobots: true})
+	worker := NewHostworker("test.com", crawler)
+	u, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(u, nil, false)
+
+	subdomain := worker.Subdomains["www.test.com"]
+	subdomain.Robots = &Robots{CrawlDelay: time.Minute}
+	subdomain.RobotsExpires = time.Now().Add(time.Hour)
+	subdomain.LastRequest = time.Now()
+
+	item := &CrawlItem{URL: &url.URL{Path: "/page"}, Subdomain: subdomain}
+	worker.lock.Lock()
+	allowed := worker.CheckRobots(item)
+	worker.lock.Unlock()
+
+	if allowed || item.FailCount != 0 {
+		test.Log("Item allowed or failed during long crawl-delay")
+		test.Fail()
+	}
+
+	expected := subdomain.LastRequest.Add(time.Minute)
+	if worker.WantsToGetUp() || !worker.ParkedUntil(time.Now()).Equal(expected) {
+		test.Logf("Host not parked until end of crawl-delay %v", expected)
+		test.Fail()
+	}
+}
+
+func TestRobotsFetchUnlocked(test *testing.T) {
+	var robotsHits, sitemapHits int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			atomic.AddInt32(&robotsHits, 1)
+			<-release
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		case "/sitemap.xml":
+			atomic.AddInt32(&sitemapHits, 1)
+			w.Write([]byte(`<urlset><url><loc>` + "http://" + r.Host + `/page</loc></url></urlset>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, RespectRobots: true, Sitemaps: true, MaxSitemapUrls: 10})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Hostname(), ".")), crawler)
+	worker.Client = &http.Client{}
+
+	worker.NewReference(serverUrl, nil, false)
+	subdomain := worker.Subdomains[serverUrl.Host]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.lock.Lock()
+			defer worker.lock.Unlock()
+			worker.CheckSitemaps(subdomain)
+			worker.RobotsFor(subdomain)
+		}()
+	}
+
+	// De lock blijft vrij terwijl robots.txt opgehaald wordt
+	for atomic.LoadInt32(&robotsHits) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	worker.lock.Lock()
+	worker.lock.Unlock()
+	close(release)
+	wg.Wait()
+
+	if robotsHits != 1 || sitemapHits != 1 {
+		test.Logf("robots.txt fetched %v times, sitemap %v times", robotsHits, sitemapHits)
+		test.Fail()
+	}
+	if subdomain.Robots == nil || subdomain.Robots.Allowed(&url.URL{Path: "/private/x"}) {
+		test.Log("robots.txt not applied")
+		test.Fail()
+	}
+	if subdomain.AlreadyFound["/page"] == nil {
+		test.Log("Sitemap url not added")
+		test.Fail()
+	}
+}
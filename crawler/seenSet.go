@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aantal nieuwe hashes voor ze in de gesorteerde lijst samengevoegd worden
+const seenSetMergeSize = 4096
+
+// Compacte verzameling van url's die al gecrawld werden en niet meer in een queue
+// staan. Per url bewaren we enkel een 64-bit hash en wat nodig is voor de volgende
+// recrawl (32 bytes), in plaats van een volledig CrawlItem. Twee url's met dezelfde
+// hash zijn zeldzaam genoeg om als gezien te beschouwen.
+type SeenSet struct {
+	// Gesorteerd op hash, values[i] hoort bij hashes[i]
+	hashes []uint64
+	values []seenEntry
+
+	// Nieuwe hashes, nog niet gesorteerd
+	pending map[uint64]seenEntry
+}
+
+// Wat we van een gecompacteerd item onthouden
+type seenEntry struct {
+	value    uint32 // Cycle in de hoogste bits, de laagste bit geeft aan of de url genegeerd wordt
+	download uint32 // LastDownload in minuten sinds 1970 (0 = nooit)
+	interval uint32 // ChangeInterval in seconden
+	queries  uint32 // Begin van QueryVersion
+	content  uint64 // Begin van ContentHash
+}
+
+func NewSeenSet() *SeenSet {
+	return &SeenSet{pending: make(map[uint64]seenEntry)}
+}
+
+func seenHash(uri string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(uri))
+	return h.Sum64()
+}
+
+func newSeenEntry(item *CrawlItem) seenEntry {
+	entry := seenEntry{value: uint32(item.Cycle) << 1, interval: uint32(item.ChangeInterval / time.Second)}
+	if item.Ignore {
+		entry.value |= 1
+	}
+	if item.LastDownload != nil && item.LastDownload.Unix() > 0 {
+		entry.download = uint32(item.LastDownload.Unix() / 60)
+	}
+	if len(item.QueryVersion) >= 8 {
+		if v, err := strconv.ParseUint(item.QueryVersion[:8], 16, 32); err == nil {
+			entry.queries = uint32(v)
+		}
+	}
+	if len(item.ContentHash) >= 16 {
+		if v, err := strconv.ParseUint(item.ContentHash[:16], 16, 64); err == nil {
+			entry.content = v
+		}
+	}
+	return entry
+}
+
+func (e seenEntry) Cycle() int {
+	return int(e.value >> 1)
+}
+
+func (e seenEntry) Ignore() bool {
+	return e.value&1 == 1
+}
+
+// Zet de bewaarde gegevens terug in een item. ContentHash en QueryVersion zijn
+// daarna enkel het begin van de oorspronkelijke waarde (zie ProcessResponse)
+func (e seenEntry) restore(item *CrawlItem) {
+	item.Cycle = e.Cycle()
+	item.Ignore = e.Ignore()
+	item.ChangeInterval = time.Duration(e.interval) * time.Second
+	if e.download > 0 {
+		download := time.Unix(int64(e.download)*60, 0)
+		item.LastDownload = &download
+	}
+	if e.queries != 0 {
+		item.QueryVersion = fmt.Sprintf("%08x", e.queries)
+	}
+	if e.content != 0 {
+		item.ContentHash = fmt.Sprintf("%016x", e.content)
+	}
+}
+
+// Eén lijn in het bestand van de worker. Oudere bestanden hebben enkel index, hash en value
+func (e seenEntry) format(index int, hash uint64) string {
+	return fmt.Sprintf("%v\t%x\t%v\t%v\t%v\t%x\t%x\n", index, hash, e.value, e.download, e.interval, e.queries, e.content)
+}
+
+func parseSeenEntry(line string) (index int, hash uint64, entry seenEntry, ok bool) {
+	parts := strings.Split(line, "\t")
+	if len(parts) != 3 && len(parts) != 7 {
+		return 0, 0, entry, false
+	}
+
+	var err error
+	if index, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, entry, false
+	}
+	if hash, err = strconv.ParseUint(parts[1], 16, 64); err != nil {
+		return 0, 0, entry, false
+	}
+
+	fields := []*uint32{&entry.value, &entry.download, &entry.interval}
+	for i := 2; i < len(parts) && i-2 < len(fields); i++ {
+		v, err := strconv.ParseUint(parts[i], 10, 32)
+		if err != nil {
+			return 0, 0, entry, false
+		}
+		*fields[i-2] = uint32(v)
+	}
+
+	if len(parts) == 7 {
+		queries, err := strconv.ParseUint(parts[5], 16, 32)
+		if err != nil {
+			return 0, 0, entry, false
+		}
+		entry.queries = uint32(queries)
+
+		if entry.content, err = strconv.ParseUint(parts[6], 16, 64); err != nil {
+			return 0, 0, entry, false
+		}
+	}
+	return index, hash, entry, true
+}
+
+func (s *SeenSet) Add(uri string, entry seenEntry) {
+	s.addHash(seenHash(uri), entry)
+}
+
+func (s *SeenSet) addHash(hash uint64, entry seenEntry) {
+	if i := s.search(hash); i >= 0 {
+		s.values[i] = entry
+		return
+	}
+
+	s.pending[hash] = entry
+	if len(s.pending) >= seenSetMergeSize {
+		s.merge()
+	}
+}
+
+func (s *SeenSet) Lookup(uri string) (seenEntry, bool) {
+	hash := seenHash(uri)
+
+	entry, ok := s.pending[hash]
+	if !ok {
+		i := s.search(hash)
+		if i < 0 {
+			return entry, false
+		}
+		entry = s.values[i]
+	}
+	return entry, true
+}
+
+func (s *SeenSet) search(hash uint64) int {
+	i := sort.Search(len(s.hashes), func(i int) bool { return s.hashes[i] >= hash })
+	if i < len(s.hashes) && s.hashes[i] == hash {
+		return i
+	}
+	return -1
+}
+
+// Voegt de nieuwe hashes samen met de gesorteerde lijst
+func (s *SeenSet) merge() {
+	if len(s.pending) == 0 {
+		return
+	}
+
+	added := make([]uint64, 0, len(s.pending))
+	for hash := range s.pending {
+		added = append(added, hash)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+
+	hashes := make([]uint64, 0, len(s.hashes)+len(added))
+	values := make([]seenEntry, 0, len(s.hashes)+len(added))
+	i, j := 0, 0
+	for i < len(s.hashes) || j < len(added) {
+		if j == len(added) || (i < len(s.hashes) && s.hashes[i] < added[j]) {
+			hashes = append(hashes, s.hashes[i])
+			values = append(values, s.values[i])
+			i++
+		} else {
+			hashes = append(hashes, added[j])
+			values = append(values, s.pending[added[j]])
+			j++
+		}
+	}
+
+	s.hashes = hashes
+	s.values = values
+	s.pending = make(map[uint64]seenEntry)
+}
+
+func (s *SeenSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.hashes) + len(s.pending)
+}
+
+// Overloopt alle hashes in gesorteerde volgorde
+func (s *SeenSet) each(f func(hash uint64, entry seenEntry)) {
+	s.merge()
+	for i, hash := range s.hashes {
+		f(hash, s.values[i])
+	}
+}
+
+// Vervangt een afgewerkt item door een hash in de SeenSet van zijn subdomein. Enkel
+// voor genegeerde items en items vanaf maxRecrawlDepth: introduction points, items in
+// een queue, mislukte items en pagina's die elke cycle opnieuw gecrawld worden
+// (met hun validators en links) blijven volledig in memory. Het recrawl interval en
+// de hash van de inhoud blijven bewaard.
+func (w *Hostworker) compactItem(item *CrawlItem) {
+	if !w.crawler.cfg.CompactSeen || item.Subdomain == nil || item.Queue != nil || item.Depth == 0 || item.FailCount > 0 {
+		return
+	}
+	if !item.Ignore && (item.Depth < maxRecrawlDepth || item.LastDownload == nil) {
+		return
+	}
+	if item.URL.IsAbs() {
+		return
+	}
+
+	uri := cleanURLPath(item.URL)
+	if item.Subdomain.AlreadyFound[uri] != item {
+		return
+	}
+
+	if item.Subdomain.Seen == nil {
+		item.Subdomain.Seen = NewSeenSet()
+	}
+	item.Subdomain.Seen.Add(uri, newSeenEntry(item))
+	delete(item.Subdomain.AlreadyFound, uri)
+}
+
+// Zoekt een url op in de SeenSet. Als de url opnieuw gecrawld moet worden (interne link
+// uit een nieuwere cycle waarvan de recrawl nodig is, of een link van een andere host)
+// krijgen we terug een volledig item, anders nil en found = true.
+func (w *Hostworker) lookupSeen(subdomain *Subdomain, uri string, foundUrl *url.URL, sourceItem *CrawlItem, internal bool) (*CrawlItem, bool) {
+	if subdomain.Seen == nil {
+		return nil, false
+	}
+
+	entry, found := subdomain.Seen.Lookup(uri)
+	if !found {
+		return nil, false
+	}
+
+	if entry.Ignore() || (internal && entry.Cycle() >= sourceItem.Cycle) {
+		return nil, true
+	}
+
+	item := NewCrawlItem(foundUrl)
+	item.Subdomain = subdomain
+	entry.restore(item)
+	item.Depth = maxRecrawlDepth
+	if internal {
+		item.Depth = sourceItem.Depth + 1
+
+		if !w.RecrawlDue(item) {
+			// Nog niet aan de beurt: enkel de cycle aanpassen, zoals in NewReference
+			item.Cycle = sourceItem.Cycle
+			subdomain.Seen.Add(uri, newSeenEntry(item))
+			return nil, true
+		}
+	}
+
+	subdomain.AlreadyFound[uri] = item
+	return item, true
+}
@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeenSet(test *testing.T) {
+	set := NewSeenSet()
+	count := 3*seenSetMergeSize + 10
+	for i := 0; i < count; i++ {
+		set.Add(fmt.Sprintf("/page/%v", i), newSeenEntry(&CrawlItem{Cycle: i % 7, Ignore: i%5 == 0}))
+	}
+
+	if set.Len() != count {
+		test.Logf("Expected %v items, got %v", count, set.Len())
+		test.Fail()
+	}
+
+	for i := 0; i < count; i++ {
+		entry, found := set.Lookup(fmt.Sprintf("/page/%v", i))
+		if !found || entry.Cycle() != i%7 || entry.Ignore() != (i%5 == 0) {
+			test.Logf("Wrong lookup for %v: %+v %v", i, entry, found)
+			test.Fail()
+			break
+		}
+	}
+
+	// Bestaande url aanpassen
+	set.Add("/page/1", newSeenEntry(&CrawlItem{Cycle: 42}))
+	if entry, _ := set.Lookup("/page/1"); entry.Cycle() != 42 || set.Len() != count {
+		test.Log("Existing url not updated")
+		test.Fail()
+	}
+
+	if _, found := set.Lookup("/other"); found {
+		test.Log("Unknown url found")
+		test.Fail()
+	}
+
+	// Gegevens voor de recrawl blijven bewaard, ook na opslaan
+	download := time.Date(2017, 5, 1, 10, 30, 0, 0, time.UTC)
+	item := &CrawlItem{Cycle: 3, LastDownload: &download, ChangeInterval: 36 * time.Hour, ContentHash: "0123456789abcdef0011223344556677", QueryVersion: "89abcdef01234567"}
+	entry := newSeenEntry(item)
+	index, hash, parsed, ok := parseSeenEntry(strings.TrimSuffix(entry.format(2, 77), "\n"))
+	if !ok || index != 2 || hash != 77 || parsed != entry {
+		test.Logf("Seen entry not saved: %+v", parsed)
+		test.Fail()
+	}
+
+	restored := &CrawlItem{}
+	parsed.restore(restored)
+	if restored.Cycle != 3 || restored.LastDownload == nil || !restored.LastDownload.Equal(download) || restored.ChangeInterval != item.ChangeInterval ||
+		restored.ContentHash == "" || !strings.HasPrefix(item.ContentHash, restored.ContentHash) || !strings.HasPrefix(item.QueryVersion, restored.QueryVersion) {
+		test.Logf("Wrong restored item %+v", restored)
+		test.Fail()
+	}
+
+	// Oudere bestanden: enkel cycle en ignore
+	if _, _, old, ok := parseSeenEntry("0\tff\t7"); !ok || old.Cycle() != 3 || !old.Ignore() {
+		test.Log("Old seen entry not read")
+		test.Fail()
+	}
+}
+
+func TestCompactSeen(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, CompactSeen: true})
+	worker := NewHostworker("test.com", crawler)
+
+	root, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(root, nil, false)
+	subdomain := worker.Subdomains["www.test.com"]
+
+	// Diepe pagina downloaden
+	source := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: 0}
+	deep, _ := url.Parse("http://www.test.com/deep")
+	item, _ := worker.NewReference(deep, source, true)
+	item.Remove()
+	worker.RequestStarted(item)
+	worker.RequestFinished(item)
+
+	if _, ok := subdomain.AlreadyFound["/deep"]; ok || subdomain.Seen.Len() != 1 {
+		test.Log("Finished deep item not compacted")
+		test.Fail()
+	}
+
+	// Genegeerde pagina
+	ignored, _ := url.Parse("http://www.test.com/file.zip")
+	item, _ = worker.NewReference(ignored, source, true)
+	item.Remove()
+	worker.RequestIgnored(item)
+
+	// Zelfde cycle: niet opnieuw
+	if item, _ := worker.NewReference(deep, source, true); item != nil {
+		test.Log("Seen item returned in same cycle")
+		test.Fail()
+	}
+
+	// Opgeslagen en terug ingelezen
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	worker.SaveToWriter(writer)
+	writer.Flush()
+
+	loaded := NewHostworker("test.com", crawler)
+	if !loaded.ReadFromReader(bufio.NewReader(&buffer)) || loaded.Subdomains["www.test.com"].Seen.Len() != 2 {
+		test.Log("Seen set not saved")
+		test.Fail()
+		return
+	}
+
+	// Nieuwere cycle: terug een volledig item voor de recrawl, behalve als het genegeerd wordt
+	newer := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: 1}
+	item, _ = loaded.NewReference(deep, newer, true)
+	if item == nil || item.Cycle != 1 || item.Depth != maxRecrawlDepth || item.Queue != loaded.LowPriorityQueue {
+		test.Log("Seen item not recrawled in newer cycle")
+		test.Fail()
+	}
+
+	if item, _ := loaded.NewReference(ignored, newer, true); item != nil {
+		test.Log("Ignored item recrawled")
+		test.Fail()
+	}
+}
+
+func TestCompactSeenRecrawl(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, CompactSeen: true, RecrawlInterval: 60, RecrawlMaxInterval: 600})
+	worker := NewHostworker("test.com", crawler)
+
+	root, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(root, nil, false)
+	subdomain := worker.Subdomains["www.test.com"]
+
+	source := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: 0}
+	deep, _ := url.Parse("http://www.test.com/deep")
+	item, _ := worker.NewReference(deep, source, true)
+	item.Remove()
+	item.ChangeInterval = time.Hour
+	item.ContentHash = "0123456789abcdef0011223344556677"
+	worker.RequestStarted(item)
+	worker.RequestFinished(item)
+
+	// Nieuwe cycle, maar de pagina verandert maar om het uur
+	newer := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: 1}
+	deep, _ = url.Parse("http://www.test.com/deep")
+	if item, _ := worker.NewReference(deep, newer, true); item != nil || worker.RecrawlSkipped != 1 {
+		test.Log("Compacted item recrawled before its change interval")
+		test.Fail()
+	}
+	if entry, _ := subdomain.Seen.Lookup("/deep"); entry.Cycle() != 1 {
+		test.Logf("Cycle of skipped item not updated: %v", entry.Cycle())
+		test.Fail()
+	}
+
+	// Twee uur later wel
+	entry, _ := subdomain.Seen.Lookup("/deep")
+	entry.download -= 120
+	subdomain.Seen.Add("/deep", entry)
+
+	newest := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: 2}
+	deep, _ = url.Parse("http://www.test.com/deep")
+	item, _ = worker.NewReference(deep, newest, true)
+	if item == nil || item.LastDownload == nil || item.ChangeInterval != time.Hour || item.ContentHash == "" || item.Queue != worker.LowPriorityQueue {
+		test.Log("Compacted item not recrawled with its recrawl data")
+		test.Fail()
+	}
+}
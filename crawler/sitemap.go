@@ -0,0 +1,280 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Maximale grootte van een (uitgepakte) sitemap volgens sitemaps.org
+const maxSitemapSize = 50 * 1024 * 1024
+
+// Maximum aantal sitemap bestanden per subdomein (indexen inbegrepen)
+const maxSitemapFiles = 50
+
+// Hoe vaak we de sitemaps van een subdomein opnieuw inlezen
+const sitemapInterval = 24 * time.Hour
+
+// Eén url uit een sitemap
+type SitemapEntry struct {
+	Loc     string
+	LastMod *time.Time
+}
+
+var lastModFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseLastMod(str string) *time.Time {
+	str = strings.TrimSpace(str)
+	for _, format := range lastModFormats {
+		if t, err := time.Parse(format, str); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// Leest een sitemap (urlset), sitemap index of tekstbestand met één url per lijn.
+// Gzip wordt automatisch uitgepakt. Bij een fout worden de url's tot dan toch teruggegeven.
+func ParseSitemap(reader io.Reader) ([]*SitemapEntry, []string, error) {
+	buffered := bufio.NewReader(reader)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		buffered = bufio.NewReader(gz)
+	}
+
+	limited := bufio.NewReader(io.LimitReader(buffered, maxSitemapSize))
+	first, err := firstNonSpace(limited)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if first != '<' {
+		return parseTextSitemap(limited)
+	}
+	return parseXmlSitemap(limited)
+}
+
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for i := 1; ; i++ {
+		b, err := reader.Peek(i)
+		if err != nil {
+			return 0, err
+		}
+		c := b[i-1]
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != 0xef && c != 0xbb && c != 0xbf {
+			return c, nil
+		}
+	}
+}
+
+func parseTextSitemap(reader io.Reader) ([]*SitemapEntry, []string, error) {
+	entries := make([]*SitemapEntry, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			entries = append(entries, &SitemapEntry{Loc: line})
+		}
+	}
+	return entries, nil, scanner.Err()
+}
+
+func parseXmlSitemap(reader io.Reader) ([]*SitemapEntry, []string, error) {
+	entries := make([]*SitemapEntry, 0)
+	sitemaps := make([]string, 0)
+
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	// Huidige <url> of <sitemap> en de tekst van het huidige element
+	var entry *SitemapEntry
+	inIndex := false
+	text := bytes.NewBuffer(nil)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return entries, sitemaps, nil
+		}
+		if err != nil {
+			return entries, sitemaps, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "url":
+				entry = &SitemapEntry{}
+				inIndex = false
+			case "sitemap":
+				entry = &SitemapEntry{}
+				inIndex = true
+			}
+			text.Reset()
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			if entry == nil {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "loc":
+				entry.Loc = strings.TrimSpace(text.String())
+			case "lastmod":
+				entry.LastMod = parseLastMod(text.String())
+			case "url", "sitemap":
+				if entry.Loc != "" {
+					if inIndex {
+						sitemaps = append(sitemaps, entry.Loc)
+					} else {
+						entries = append(entries, entry)
+					}
+				}
+				entry = nil
+			}
+			text.Reset()
+		}
+	}
+}
+
+// Leest de sitemaps van een subdomein in als dat de laatste dag nog niet gebeurde.
+// Sitemaps worden gezocht in robots.txt en op /sitemap.xml
+func (w *Hostworker) CheckSitemaps(subdomain *Subdomain) {
+	if !w.crawler.cfg.Sitemaps {
+		return
+	}
+
+	host := subdomain.Url.Host
+	if last, ok := w.SitemapsFetched[host]; ok && time.Since(last) < sitemapInterval {
+		return
+	}
+	// Meteen markeren: andere goroutines slaan de sitemaps over terwijl we ze ophalen
+	w.SitemapsFetched[host] = time.Now()
+
+	scheme := subdomain.Url.Scheme
+	if scheme == "" {
+		scheme = w.Scheme
+	}
+
+	pending := append([]string{}, w.RobotsFor(subdomain).Sitemaps...)
+	pending = append(pending, scheme+"://"+host+"/sitemap.xml")
+	visited := make(map[string]bool)
+	added := 0
+
+	for len(pending) > 0 && len(visited) < maxSitemapFiles && added < w.crawler.cfg.MaxSitemapUrls {
+		location := pending[0]
+		pending = pending[1:]
+		if visited[location] {
+			continue
+		}
+		visited[location] = true
+
+		var entries []*SitemapEntry
+		var sitemaps []string
+		w.unlocked(func() {
+			entries, sitemaps = w.fetchSitemap(location)
+		})
+		pending = append(pending, sitemaps...)
+
+		for _, entry := range entries {
+			if added >= w.crawler.cfg.MaxSitemapUrls {
+				break
+			}
+			if w.AddSitemapUrl(entry) {
+				added++
+			}
+		}
+	}
+
+	if w.crawler.cfg.LogNetwork && added > 0 {
+		w.crawler.cfg.Log("sitemap", fmt.Sprintf("%v urls from %v sitemaps for %v", added, len(visited), host))
+	}
+}
+
+// Haalt een sitemap op en leest die in, wordt uitgevoerd zonder w.lock
+func (w *Hostworker) fetchSitemap(location string) ([]*SitemapEntry, []string) {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(u.Scheme, "http") || w.crawler.Blocklist.BlocksUrl(u) {
+		return nil, nil
+	}
+
+	request, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, nil
+	}
+	request.Header.Add("User-Agent", w.crawler.cfg.UserAgent)
+	request = request.WithContext(distributors.WithRedirectFilter(w.crawler.context, func(u *url.URL) bool {
+		return !w.crawler.Blocklist.BlocksUrl(u)
+	}))
+
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return nil, nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, nil
+	}
+
+	entries, sitemaps, err := ParseSitemap(response.Body)
+	if err != nil && w.crawler.cfg.LogNetwork {
+		w.crawler.cfg.Log("sitemap", err.Error())
+	}
+	return entries, sitemaps
+}
+
+// Voegt een url uit een sitemap toe aan de Queue van deze host. Als de pagina
+// volgens lastmod gewijzigd is sinds de laatste download, krijgt de recrawl voorrang.
+func (w *Hostworker) AddSitemapUrl(entry *SitemapEntry) bool {
+	u, err := url.Parse(entry.Loc)
+	if err != nil || !strings.HasPrefix(u.Scheme, "http") || len(u.Host) == 0 {
+		return false
+	}
+
+	// Enkel url's van deze host
+	if w.crawler.GetDomainForUrl(strings.Split(u.Hostname(), ".")) != w.Host {
+		return false
+	}
+
+	// Nieuwe items komen zo in de gewone Queue terecht, niet in de PriorityQueue
+	source := &CrawlItem{Depth: maxRecrawlDepth - 1, Cycle: w.LatestCycle}
+	item, _ := w.NewReference(u, source, true)
+	if item == nil {
+		return false
+	}
+
+	if entry.LastMod != nil && item.LastDownload != nil && entry.LastMod.After(*item.LastDownload) {
+		// Gewijzigd: voor de andere recrawls plaatsen
+		if item.Queue == w.LowPriorityQueue {
+			item.Remove()
+		}
+		if item.Queue == nil {
+			w.Queue.Push(item)
+		}
+	}
+	return true
+}
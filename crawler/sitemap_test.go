@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSitemap(test *testing.T) {
+	urlset := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc> http://www.test.com/a </loc><lastmod>2017-05-01</lastmod></url>
+	<url><loc>http://www.test.com/b</loc><lastmod>2017-05-02T10:00:00+02:00</lastmod><priority>0.5</priority></url>
+	<url><priority>1</priority></url>
+</urlset>`)
+
+	// Gzip versie moet hetzelfde resultaat geven
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(urlset)
+	gz.Close()
+
+	for _, data := range [][]byte{urlset, compressed.Bytes()} {
+		entries, sitemaps, err := ParseSitemap(bytes.NewReader(data))
+		if err != nil || len(sitemaps) != 0 || len(entries) != 2 {
+			test.Logf("Wrong sitemap result: %v %v %v", entries, sitemaps, err)
+			test.Fail()
+			continue
+		}
+
+		if entries[0].Loc != "http://www.test.com/a" || entries[0].LastMod == nil || entries[0].LastMod.Day() != 1 {
+			test.Logf("Wrong first entry %+v", entries[0])
+			test.Fail()
+		}
+		if entries[1].LastMod == nil || entries[1].LastMod.UTC().Hour() != 8 {
+			test.Logf("Wrong lastmod %v", entries[1].LastMod)
+			test.Fail()
+		}
+	}
+
+	index := []byte(`<sitemapindex><sitemap><loc>http://www.test.com/sitemap1.xml.gz</loc></sitemap><sitemap><loc>http://www.test.com/sitemap2.xml</loc></sitemap></sitemapindex>`)
+	entries, sitemaps, _ := ParseSitemap(bytes.NewReader(index))
+	if len(entries) != 0 || len(sitemaps) != 2 || sitemaps[0] != "http://www.test.com/sitemap1.xml.gz" {
+		test.Logf("Wrong sitemap index result: %v %v", entries, sitemaps)
+		test.Fail()
+	}
+
+	text := []byte("http://www.test.com/a\n\nnot an url\nhttps://www.test.com/b\n")
+	entries, _, _ = ParseSitemap(bytes.NewReader(text))
+	if len(entries) != 2 || entries[1].Loc != "https://www.test.com/b" {
+		test.Logf("Wrong text sitemap result: %v", entries)
+		test.Fail()
+	}
+
+	robots := ParseRobots([]byte("User-agent: *\nDisallow:\nSitemap: http://www.test.com/sitemap_index.xml\n"), "LanternCrawler")
+	if len(robots.Sitemaps) != 1 || robots.Sitemaps[0] != "http://www.test.com/sitemap_index.xml" {
+		test.Logf("Sitemap in robots.txt not found: %v", robots.Sitemaps)
+		test.Fail()
+	}
+}
+
+func TestAddSitemapUrl(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	worker := NewHostworker("test.com", crawler)
+
+	start, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(start, nil, false)
+
+	if !worker.AddSitemapUrl(&SitemapEntry{Loc: "http://www.test.com/new"}) {
+		test.Log("Sitemap url not added")
+		test.Fail()
+	}
+
+	if worker.AddSitemapUrl(&SitemapEntry{Loc: "http://www.other.com/page"}) {
+		test.Log("Sitemap url of other host added")
+		test.Fail()
+	}
+
+	item := worker.Queue.First
+	if item == nil || item.URL.Path != "/new" {
+		test.Log("Sitemap url should be in the normal queue")
+		test.Fail()
+		return
+	}
+
+	// Gedownload, en daarna gewijzigd volgens de sitemap
+	item.Remove()
+	downloaded := time.Now().Add(-time.Hour)
+	item.LastDownload = &downloaded
+
+	now := time.Now()
+	worker.AddSitemapUrl(&SitemapEntry{Loc: "http://www.test.com/new", LastMod: &now})
+	if item.Queue != worker.Queue {
+		test.Log("Modified page should be queued for recrawl")
+		test.Fail()
+	}
+}
@@ -0,0 +1,365 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxQueryParams = 12
+
+	// Aantal patronen dat we per host bijhouden (geheugen)
+	maxTrackedPatterns = 10000
+
+	// Pagina's zijn bijna identiek als hun simhash maar zoveel bits verschilt
+	maxSimhashDistance = 3
+)
+
+type trapPattern struct {
+	Urls int
+
+	// Inhoud van pagina's met dit patroon
+	Pages      int
+	Duplicates int
+	Simhash    uint64
+	HasSimhash bool
+
+	Quarantine *queries.QuarantinedPattern
+}
+
+// Herkent crawler traps (kalenders, gefacetteerd zoeken, sessies in paden...) per host.
+// Patronen die in de val lopen worden in quarantaine gezet: nieuwe url's met dat
+// patroon worden niet meer toegevoegd tot de quarantaine verloopt.
+type TrapDetector struct {
+	SegmentRepeatLimit int           // Aantal keer dat een padsegment mag voorkomen, /a/b/a/b/... (0 = onbeperkt)
+	PatternLimit       int           // Aantal url's per patroon (0 = onbeperkt)
+	QueryVariantLimit  int           // Aantal verschillende queries per pad (0 = onbeperkt)
+	DuplicateLimit     int           // Aantal bijna identieke pagina's per patroon (0 = niet controleren)
+	QuarantineTime     time.Duration // Duur van een quarantaine (0 = blijvend)
+
+	patterns map[string]*trapPattern
+	queries  map[string]int
+
+	Rejected int
+	changed  bool
+}
+
+func NewTrapDetector(segmentRepeatLimit, patternLimit, queryVariantLimit, duplicateLimit int, quarantineTime time.Duration) *TrapDetector {
+	return &TrapDetector{
+		SegmentRepeatLimit: segmentRepeatLimit,
+		PatternLimit:       patternLimit,
+		QueryVariantLimit:  queryVariantLimit,
+		DuplicateLimit:     duplicateLimit,
+		QuarantineTime:     quarantineTime,
+		patterns:           make(map[string]*trapPattern),
+		queries:            make(map[string]int),
+	}
+}
+
+// Geeft false als de (relatieve) url niet toegevoegd mag worden
+func (t *TrapDetector) Allow(u *url.URL) bool {
+	repeated := t.SegmentRepeatLimit > 0 && hasRepeatedSegments(u.Path, t.SegmentRepeatLimit)
+	if repeated || strings.Count(u.RawQuery, "&")+1 > maxQueryParams {
+		t.Rejected++
+		t.changed = true
+		return false
+	}
+
+	now := time.Now()
+	for _, key := range []string{urlPattern(u), queryPattern(u)} {
+		if p := t.patterns[key]; p != nil && p.Quarantine != nil {
+			if !p.Quarantine.Until.IsZero() && now.After(p.Quarantine.Until) {
+				// Verlopen: het patroon krijgt een nieuwe kans met lege tellers
+				delete(t.patterns, key)
+				if key == queryPattern(u) {
+					delete(t.queries, u.Path)
+				}
+				t.changed = true
+				continue
+			}
+
+			p.Quarantine.Rejected++
+			t.changed = true
+			return false
+		}
+	}
+	return true
+}
+
+// Een nieuwe url werd toegevoegd. Geeft het patroon terug als het daardoor in quarantaine ging.
+func (t *TrapDetector) Added(u *url.URL) *queries.QuarantinedPattern {
+	key := urlPattern(u)
+	p := t.pattern(key)
+	if p != nil {
+		p.Urls++
+		if t.PatternLimit > 0 && p.Urls > t.PatternLimit {
+			return t.quarantine(key, p, "too many urls")
+		}
+	}
+
+	if len(u.RawQuery) == 0 {
+		return nil
+	}
+
+	t.queries[u.Path]++
+	if t.QueryVariantLimit > 0 && t.queries[u.Path] > t.QueryVariantLimit {
+		key = queryPattern(u)
+		if p := t.pattern(key); p != nil {
+			return t.quarantine(key, p, "parameter explosion")
+		}
+	}
+	return nil
+}
+
+// Een pagina werd gedownload. Als te veel pagina's met hetzelfde patroon dezelfde
+// inhoud hebben, gaat het patroon in quarantaine.
+func (t *TrapDetector) ContentSeen(u *url.URL, text []byte) *queries.QuarantinedPattern {
+	if t.DuplicateLimit <= 0 {
+		return nil
+	}
+
+	key := urlPattern(u)
+	p := t.pattern(key)
+	if p == nil {
+		return nil
+	}
+
+	hash := simhash(text)
+	p.Pages++
+	if !p.HasSimhash {
+		p.Simhash = hash
+		p.HasSimhash = true
+		return nil
+	}
+
+	if hammingDistance(p.Simhash, hash) <= maxSimhashDistance {
+		p.Duplicates++
+	}
+
+	// Minstens 90% van de pagina's is identiek
+	if p.Duplicates >= t.DuplicateLimit && p.Duplicates*10 >= p.Pages*9 {
+		return t.quarantine(key, p, "duplicate content")
+	}
+	return nil
+}
+
+func (t *TrapDetector) pattern(key string) *trapPattern {
+	p := t.patterns[key]
+	if p == nil {
+		if len(t.patterns) >= maxTrackedPatterns {
+			return nil
+		}
+		p = &trapPattern{}
+		t.patterns[key] = p
+	}
+	return p
+}
+
+func (t *TrapDetector) quarantine(key string, p *trapPattern, reason string) *queries.QuarantinedPattern {
+	if p.Quarantine != nil {
+		return nil
+	}
+
+	p.Quarantine = &queries.QuarantinedPattern{Pattern: key, Reason: reason, Since: time.Now()}
+	if t.QuarantineTime > 0 {
+		p.Quarantine.Until = p.Quarantine.Since.Add(t.QuarantineTime)
+	}
+	t.changed = true
+	return p.Quarantine
+}
+
+// Geeft aan of er iets veranderd is sinds de laatste keer dat de statistieken opgevraagd werden
+func (t *TrapDetector) Changed() bool {
+	return t.changed
+}
+
+func (t *TrapDetector) Quarantined() []*queries.QuarantinedPattern {
+	list := make([]*queries.QuarantinedPattern, 0)
+	for _, p := range t.patterns {
+		if p.Quarantine != nil {
+			list = append(list, p.Quarantine)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Pattern < list[j].Pattern
+	})
+	return list
+}
+
+// Vult de trap statistieken van een host in
+func (t *TrapDetector) FillStats(stats *queries.HostStats) {
+	stats.TrapRejected = t.Rejected
+	stats.Quarantined = t.Quarantined()
+	t.changed = false
+}
+
+// Slaat de patronen in quarantaine op, één per lijn
+func (t *TrapDetector) SaveToWriter(writer *bufio.Writer) {
+	for _, q := range t.Quarantined() {
+		if strings.ContainsAny(q.Pattern, "\t\n") {
+			continue
+		}
+
+		var until *time.Time
+		if !q.Until.IsZero() {
+			until = &q.Until
+		}
+		writer.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%v\n", q.Pattern, q.Reason, TimeToString(&q.Since), TimeToString(until), q.Rejected))
+	}
+}
+
+// Leest een patroon in quarantaine terug in (zie SaveToWriter)
+func (t *TrapDetector) ReadFromString(str string) bool {
+	parts := strings.Split(str, "\t")
+	if len(parts) != 5 {
+		return false
+	}
+
+	since, err := time.Parse(crawlItemTimeFormat, parts[2])
+	if err != nil {
+		return false
+	}
+
+	var until time.Time
+	if len(parts[3]) > 0 {
+		until, err = time.Parse(crawlItemTimeFormat, parts[3])
+		if err != nil {
+			return false
+		}
+	}
+
+	rejected, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return false
+	}
+
+	p := t.pattern(parts[0])
+	if p == nil {
+		return false
+	}
+	p.Quarantine = &queries.QuarantinedPattern{Pattern: parts[0], Reason: parts[1], Since: since, Until: until, Rejected: rejected}
+	return true
+}
+
+func hasRepeatedSegments(path string, limit int) bool {
+	counts := make(map[string]int)
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) == 0 {
+			continue
+		}
+
+		counts[segment]++
+		if counts[segment] > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// Patroon van een url: cijfers en id's in het pad vervangen, enkel de namen van query parameters.
+// /calendar/2017/05?day=3&view=week -> /calendar/#/#?day&view
+func urlPattern(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = segmentPattern(segment)
+	}
+	pattern := strings.Join(segments, "/")
+
+	if len(u.RawQuery) == 0 {
+		return pattern
+	}
+
+	names := make([]string, 0, 4)
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if eq := strings.Index(param, "="); eq != -1 {
+			param = param[:eq]
+		}
+		names = append(names, param)
+	}
+	sort.Strings(names)
+	return pattern + "?" + strings.Join(names, "&")
+}
+
+// Alle queries op hetzelfde pad
+func queryPattern(u *url.URL) string {
+	return u.Path + "?*"
+}
+
+func segmentPattern(segment string) string {
+	digits := 0
+	for i := 0; i < len(segment); i++ {
+		if segment[i] >= '0' && segment[i] <= '9' {
+			digits++
+		}
+	}
+
+	if digits == 0 {
+		return segment
+	}
+
+	// Lange tokens (hashes, sessies) volledig vervangen
+	if len(segment) >= 16 && digits >= 2 {
+		return "{id}"
+	}
+
+	// Reeksen cijfers vervangen: page12 -> page#, 2017-05-01 -> #-#-#
+	pattern := make([]byte, 0, len(segment))
+	for i := 0; i < len(segment); i++ {
+		if segment[i] >= '0' && segment[i] <= '9' {
+			if len(pattern) == 0 || pattern[len(pattern)-1] != '#' {
+				pattern = append(pattern, '#')
+			}
+			continue
+		}
+		pattern = append(pattern, segment[i])
+	}
+	return string(pattern)
+}
+
+// 64 bit simhash over de woorden van een tekst
+func simhash(text []byte) uint64 {
+	var weights [64]int
+
+	words := strings.FieldsFunc(string(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for _, word := range words {
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		value := hash.Sum64()
+
+		for i := uint(0); i < 64; i++ {
+			if value&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	var result uint64
+	for i := uint(0); i < 64; i++ {
+		if weights[i] > 0 {
+			result |= 1 << i
+		}
+	}
+	return result
+}
+
+func hammingDistance(a, b uint64) int {
+	distance := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		distance++
+	}
+	return distance
+}
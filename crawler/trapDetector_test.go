@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUrlPattern(test *testing.T) {
+	cases := map[string]string{
+		"/calendar/2017/05?view=week&day=3":     "/calendar/#/#?day&view",
+		"/page12":                               "/page#",
+		"/archive/2017-05-01/":                  "/archive/#-#-#/",
+		"/s/a8f5f167f44f4964e6c998dee827110c/x": "/s/{id}/x",
+		"/about":                                "/about",
+	}
+
+	for input, expected := range cases {
+		u, _ := url.Parse(input)
+		if pattern := urlPattern(u); pattern != expected {
+			test.Logf("%v has pattern %v, expected %v", input, pattern, expected)
+			test.Fail()
+		}
+	}
+}
+
+func TestTrapDetector(test *testing.T) {
+	traps := NewTrapDetector(3, 10, 20, 5, time.Hour)
+
+	// Herhaalde segmenten
+	u, _ := url.Parse("/a/b/a/b/a/b/a/b")
+	if traps.Allow(u) || traps.Rejected != 1 {
+		test.Log("Repeated segments allowed")
+		test.Fail()
+	}
+
+	// Kalender: te veel url's met hetzelfde patroon
+	var quarantined string
+	for i := 0; i < 20; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/calendar/%v", 2000+i))
+		if !traps.Allow(u) {
+			continue
+		}
+		if pattern := traps.Added(u); pattern != nil {
+			quarantined = pattern.Pattern
+		}
+	}
+
+	if quarantined != "/calendar/#" {
+		test.Logf("Calendar not quarantined, got %q", quarantined)
+		test.Fail()
+	}
+
+	u, _ = url.Parse("/calendar/3000")
+	if traps.Allow(u) {
+		test.Log("Quarantined pattern allowed")
+		test.Fail()
+	}
+
+	// Gefacetteerd zoeken: veel queries op hetzelfde pad met verschillende parameters
+	quarantined = ""
+	params := []string{"color", "size", "brand", "price", "sort", "page"}
+	for i := 0; i < 40; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/search?%v=%v&%v=x", params[i%len(params)], i, params[(i/len(params))%len(params)]))
+		if !traps.Allow(u) {
+			continue
+		}
+		if pattern := traps.Added(u); pattern != nil {
+			quarantined = pattern.Pattern
+		}
+	}
+
+	if quarantined != "/search?*" {
+		test.Logf("Parameter explosion not quarantined, got %q", quarantined)
+		test.Fail()
+	}
+
+	// Bijna identieke pagina's
+	quarantined = ""
+	for i := 0; i < 10; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/item/%v", i))
+		text := fmt.Sprintf("this item does not exist please go back to the homepage of our shop %v", i)
+		if pattern := traps.ContentSeen(u, []byte(text)); pattern != nil {
+			quarantined = pattern.Pattern
+		}
+	}
+
+	if quarantined != "/item/#" {
+		test.Logf("Duplicate content not quarantined, got %q", quarantined)
+		test.Fail()
+	}
+
+	// Verschillende pagina's niet
+	for i := 0; i < 10; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/post/%v", i))
+		text := fmt.Sprintf("post %v %v %v %v", i*7, i*13, i*101, fmt.Sprint(i*i*i))
+		if pattern := traps.ContentSeen(u, []byte(text)); pattern != nil {
+			test.Logf("Different pages quarantined: %v", pattern.Pattern)
+			test.Fail()
+		}
+	}
+
+	if !traps.Changed() || len(traps.Quarantined()) != 3 {
+		test.Logf("Expected 3 quarantined patterns, got %v", len(traps.Quarantined()))
+		test.Fail()
+	}
+}
+
+func TestTrapDefaults(test *testing.T) {
+	// Zonder limieten op het aantal url's: een groot forum is geen trap
+	traps := NewTrapDetector(3, 0, 0, 25, time.Hour)
+	for i := 0; i < 5000; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/viewtopic.php?t=%v", i))
+		if !traps.Allow(u) {
+			test.Logf("Topic %v rejected", i)
+			test.Fail()
+			return
+		}
+		if pattern := traps.Added(u); pattern != nil {
+			test.Logf("Forum quarantined as %v (%v)", pattern.Pattern, pattern.Reason)
+			test.Fail()
+			return
+		}
+	}
+}
+
+func TestTrapQuarantineExpiry(test *testing.T) {
+	traps := NewTrapDetector(3, 5, 0, 0, time.Hour)
+	for i := 0; i < 10; i++ {
+		u, _ := url.Parse(fmt.Sprintf("/calendar/%v", 2000+i))
+		traps.Added(u)
+	}
+
+	// Opslaan en terug inlezen
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	traps.SaveToWriter(writer)
+	writer.Flush()
+
+	loaded := NewTrapDetector(3, 5, 0, 0, time.Hour)
+	line, _, _ := bufio.NewReader(&buffer).ReadLine()
+	if !loaded.ReadFromString(string(line)) || len(loaded.Quarantined()) != 1 {
+		test.Logf("Quarantine not saved: %q", line)
+		test.Fail()
+		return
+	}
+
+	u, _ := url.Parse("/calendar/3000")
+	if loaded.Allow(u) {
+		test.Log("Loaded quarantine not applied")
+		test.Fail()
+	}
+
+	// Verlopen quarantaine
+	loaded.Quarantined()[0].Until = time.Now().Add(-time.Minute)
+	if !loaded.Allow(u) || len(loaded.Quarantined()) != 0 {
+		test.Log("Expired quarantine still applied")
+		test.Fail()
+	}
+}
+
+func TestTrapRecrawl(test *testing.T) {
+	var visits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Bijna dezelfde inhoud bij elk bezoek, soms met een andere teller
+		n := atomic.AddInt32(&visits, 1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<p>about our shop, we sell many things to many people visitors %v</p>", n/3)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, TrapDuplicateLimit: 5})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+
+	about, _ := url.Parse(server.URL + "/about")
+	item, _ := worker.NewReference(about, nil, false)
+	for i := 0; i < 30; i++ {
+		item.Remove()
+		worker.lock.Lock()
+		worker.Request(item)
+		worker.lock.Unlock()
+	}
+
+	if visits != 30 || len(worker.Traps.Quarantined()) != 0 {
+		test.Logf("Recrawled page quarantined after %v visits: %v", visits, len(worker.Traps.Quarantined()))
+		test.Fail()
+	}
+}
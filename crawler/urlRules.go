@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type paramFilter struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+type compiledRule struct {
+	// Naam van de regel in de statistieken ("*" voor globale regels)
+	scope    string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	params   []paramFilter
+	maxDepth int
+	weight   float64
+}
+
+// Include/exclude regels van alle hosts, opgezocht op domein of volledige host
+type RuleSet struct {
+	global []*compiledRule
+	hosts  map[string][]*compiledRule
+}
+
+// Compileert de regels. Ongeldige regexps worden overgeslagen en teruggegeven als fout
+func NewRuleSet(rules []queries.CrawlRule) (*RuleSet, []error) {
+	set := &RuleSet{hosts: make(map[string][]*compiledRule)}
+	errs := make([]error, 0)
+
+	for _, rule := range rules {
+		host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(rule.Host)), ".")
+		compiled := &compiledRule{scope: host, maxDepth: rule.MaxDepth, weight: rule.Weight}
+		if host == "" || host == "*" {
+			compiled.scope = "*"
+		}
+
+		compiled.include, errs = compileRuleRegexps(rule.Include, errs)
+		compiled.exclude, errs = compileRuleRegexps(rule.Exclude, errs)
+
+		for _, param := range rule.ExcludeParams {
+			parts := strings.SplitN(param, "=", 2)
+			filter := paramFilter{name: strings.ToLower(parts[0])}
+			if len(parts) == 2 {
+				filter.value = parts[1]
+				filter.hasValue = true
+			}
+			compiled.params = append(compiled.params, filter)
+		}
+
+		if compiled.scope == "*" {
+			set.global = append(set.global, compiled)
+		} else {
+			set.hosts[host] = append(set.hosts[host], compiled)
+		}
+	}
+	return set, errs
+}
+
+func compileRuleRegexps(patterns []string, errs []error) ([]*regexp.Regexp, []error) {
+	list := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid crawl rule %q: %v", pattern, err))
+			continue
+		}
+		list = append(list, reg)
+	}
+	return list, errs
+}
+
+// Regels die gelden voor een url: eerst de globale, dan die van het domein
+// en tenslotte die van het subdomein
+func (s *RuleSet) rulesFor(domain, host string) []*compiledRule {
+	rules := s.global
+	if list, ok := s.hosts[domain]; ok {
+		rules = append(rules[:len(rules):len(rules)], list...)
+	}
+	if host != domain {
+		if list, ok := s.hosts[host]; ok {
+			rules = append(rules[:len(rules):len(rules)], list...)
+		}
+	}
+	return rules
+}
+
+// Geeft de regel terug die de url weigert, of een lege string als de url
+// gecrawld mag worden. Include regels gelden niet voor introduction points (depth 0),
+// anders zou de startpagina van een host nooit bezocht worden.
+func (s *RuleSet) Check(domain, host string, u *url.URL, depth int) string {
+	if s == nil {
+		return ""
+	}
+
+	rules := s.rulesFor(domain, host)
+	if len(rules) == 0 {
+		return ""
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	var query url.Values
+	maxDepth := 0
+	depthScope := ""
+
+	for _, rule := range rules {
+		for _, reg := range rule.exclude {
+			if reg.MatchString(path) {
+				return rule.scope + " exclude " + reg.String()
+			}
+		}
+
+		if len(rule.params) > 0 && u.RawQuery != "" {
+			if query == nil {
+				query = u.Query()
+			}
+			for _, filter := range rule.params {
+				if filter.matches(query) {
+					return rule.scope + " param " + filter.String()
+				}
+			}
+		}
+
+		if len(rule.include) > 0 && depth > 0 {
+			included := false
+			for _, reg := range rule.include {
+				if reg.MatchString(path) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				return rule.scope + " include"
+			}
+		}
+
+		if rule.maxDepth > 0 {
+			// Specifiekere regels staan achteraan en overschrijven de vorige
+			maxDepth = rule.maxDepth
+			depthScope = rule.scope
+		}
+	}
+
+	if maxDepth > 0 && depth > maxDepth {
+		return fmt.Sprintf("%v maxDepth %v", depthScope, maxDepth)
+	}
+	return ""
+}
+
+// Gewicht van een domein volgens de regels van analisten, 1 als er geen is.
+// De laatste regel met een gewicht gaat voor
+func (s *RuleSet) Weight(domain string) float64 {
+	if s == nil {
+		return 1
+	}
+
+	weight := 1.0
+	for _, rule := range s.hosts[domain] {
+		if rule.weight > 0 {
+			weight = rule.weight
+		}
+	}
+	return weight
+}
+
+func (filter paramFilter) matches(query url.Values) bool {
+	for name, values := range query {
+		if strings.ToLower(name) != filter.name {
+			continue
+		}
+		if !filter.hasValue {
+			return true
+		}
+		for _, value := range values {
+			if value == filter.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (filter paramFilter) String() string {
+	if filter.hasValue {
+		return filter.name + "=" + filter.value
+	}
+	return filter.name
+}
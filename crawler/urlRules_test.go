@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"net/url"
+	"testing"
+)
+
+func TestRuleSet(test *testing.T) {
+	rules := []queries.CrawlRule{
+		{Exclude: []string{"^/logout"}, ExcludeParams: []string{"action=delete"}, MaxDepth: 10},
+		{Host: "market.onion", Include: []string{"^/listing/", "^/vendor/"}, Exclude: []string{"^/cart"}, MaxDepth: 3},
+		{Host: "forum.market.onion", ExcludeParams: []string{"sid"}},
+		{Host: "bad.onion", Exclude: []string{"(unclosed"}},
+	}
+
+	set, errs := NewRuleSet(rules)
+	if len(errs) != 1 {
+		test.Logf("Expected one invalid regexp, got %v", errs)
+		test.Fail()
+	}
+
+	tests := []struct {
+		domain   string
+		host     string
+		url      string
+		depth    int
+		expected string
+	}{
+		{"other.onion", "other.onion", "/logout?next=/", 1, "* exclude ^/logout"},
+		{"other.onion", "other.onion", "/page?action=delete", 1, "* param action=delete"},
+		{"other.onion", "other.onion", "/page?action=view", 1, ""},
+		{"other.onion", "other.onion", "/page", 11, "* maxDepth 10"},
+		{"market.onion", "market.onion", "/listing/123", 2, ""},
+		{"market.onion", "market.onion", "/vendor/abc", 3, ""},
+		{"market.onion", "market.onion", "/vendor/abc", 4, "market.onion maxDepth 3"},
+		{"market.onion", "market.onion", "/cart/add", 1, "market.onion exclude ^/cart"},
+		{"market.onion", "market.onion", "/faq", 1, "market.onion include"},
+		{"market.onion", "market.onion", "", 0, ""},
+		{"market.onion", "forum.market.onion", "/listing/1?SID=abc", 1, "forum.market.onion param sid"},
+		{"bad.onion", "bad.onion", "/(unclosed", 1, ""},
+	}
+
+	for _, t := range tests {
+		u, _ := url.Parse(t.url)
+		if rule := set.Check(t.domain, t.host, u, t.depth); rule != t.expected {
+			test.Logf("%v%v at depth %v: expected %q, got %q", t.host, t.url, t.depth, t.expected, rule)
+			test.Fail()
+		}
+	}
+}
+
+func TestRulesInNewReference(test *testing.T) {
+	cfg := &CrawlerConfig{Testing: true, CrawlRules: []queries.CrawlRule{{Host: "test.com", Exclude: []string{"^/logout"}}}}
+	crawler := NewCrawler(cfg)
+	worker := NewHostworker("test.com", crawler)
+
+	start, _ := url.Parse("http://www.test.com/")
+	source, _ := worker.NewReference(start, nil, false)
+
+	logout, _ := url.Parse("http://www.test.com/logout")
+	if item, _ := worker.NewReference(logout, source, true); item != nil {
+		test.Log("Excluded url was queued")
+		test.Fail()
+	}
+
+	if worker.RuleRejected["test.com exclude ^/logout"] != 1 {
+		test.Logf("Rejection not counted: %v", worker.RuleRejected)
+		test.Fail()
+	}
+}
@@ -3,9 +3,16 @@ package crawler
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/SimonBackx/lantern-crawler/distributors"
+	"github.com/SimonBackx/lantern-crawler/queries"
 	//"github.com/PuerkitoBio/purell"
+	"hash"
 	"io"
+	"io/ioutil"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -13,6 +20,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,12 +28,32 @@ const maxRecrawlDepth = 3
 const maxCrawlDepth = 40
 const maxFileSize = 2000000
 
+// Aantal bytes van de sha256 hash dat we per item bijhouden
+const contentHashSize = 16
+
 var onionRegexp = regexp.MustCompile("[^a-zA-Z2-7]+")
 
 type Subdomain struct {
 	Url          *url.URL
 	Index        int
 	AlreadyFound map[string]*CrawlItem
+
+	// Afgewerkte items die niet meer als CrawlItem bijgehouden worden
+	Seen *SeenSet
+
+	// Canonieke url's (rel=canonical) die naar een ander item verwijzen.
+	// Worden niet opgeslagen, bij een recrawl vinden we ze terug.
+	Aliases map[string]*CrawlItem
+
+	// robots.txt van dit subdomein en het tijdstip van de laatste request (crawl-delay).
+	// Worden niet opgeslagen
+	Robots         *Robots
+	RobotsExpires  time.Time
+	RobotsFailures int // Aantal keer na elkaar onbereikbaar
+	LastRequest    time.Time
+
+	// Gesloten als robots.txt opgehaald is, nil als niemand die aan het ophalen is
+	robotsFetch chan struct{}
 }
 
 type Hostworker struct {
@@ -81,7 +109,7 @@ type Hostworker struct {
 
 	InMemory              bool
 	cachedWantsToGetUp    bool
-	cachedLastDownload    *time.Time
+	cachedNextRecrawl     *time.Time
 	cachedRecrawlOnMemory bool
 
 	// Detecteren van tijdelijk onbeschikbare domeinen
@@ -92,6 +120,50 @@ type Hostworker struct {
 	FailCount      int /// Aantal mislukte downloads na elkaar
 	FailStreak     int /// Aantal keer dat FailCount > 10
 	LastFailStreak *time.Time
+
+	// Aantal timeouts na elkaar. Bij te veel timeouts vragen we een nieuw circuit aan
+	TimeoutStreak int
+
+	// Aantal 429/503 antwoorden na elkaar. Bij te veel stopt de host met een failstreak
+	ThrottleStreak int
+
+	// Hoe en op welke pagina deze host voor het eerst gevonden werd
+	DiscoveredVia LinkType
+	DiscoveredOn  string
+
+	// Detectie van crawler traps, blijft bewaard als de worker naar disk gaat
+	Traps *TrapDetector
+
+	// Aantal url's geweigerd per include/exclude regel
+	RuleRejected map[string]int
+
+	// Wanneer de sitemaps van elk subdomein het laatst ingelezen werden
+	SitemapsFetched map[string]time.Time
+
+	// Snelheid van requests naar deze host
+	Limiter *HostLimiter
+
+	// Tijdstip waarop de worker in de ParkedWorkers van de crawler staat (nul als hij er niet in staat)
+	parkedUntil time.Time
+
+	// Recente opbrengst, bepaalt de volgorde in de SleepingCrawlers
+	Value *HostValue
+
+	// Verbruik per cycle en per dag
+	Budget *CrawlBudget
+
+	// Vroegste recrawl van een pagina uit de vorige cycle (enkel in memory)
+	nextRecrawl *time.Time
+
+	// Gewijzigde pagina's en pagina's die nog niet opnieuw bezocht moesten worden
+	ChangedPages   int
+	RecrawlSkipped int
+
+	// Beschermt de toestand van de worker als er meerdere requests tegelijk lopen,
+	// met de items die op dit moment gedownload worden
+	lock           sync.Mutex
+	activeRequests int
+	inFlight       map[*CrawlItem]bool
 }
 
 func (w *Hostworker) String() string {
@@ -129,11 +201,7 @@ func NewHostWorkerFromFile(file *os.File, crawler *Crawler) *Hostworker {
 
 func (w *Hostworker) MoveToDisk() {
 	w.cachedWantsToGetUp = w.wantsToGetUp()
-	if w.IntroductionPoints.IsEmpty() {
-		w.cachedLastDownload = nil
-	} else {
-		w.cachedLastDownload = w.IntroductionPoints.First.LastDownload
-	}
+	w.cachedNextRecrawl = w.NextRecrawl()
 
 	if !w.SaveToFile() {
 		return
@@ -150,11 +218,7 @@ func (w *Hostworker) MoveToDisk() {
 /// Move out of memory without save to file
 func (w *Hostworker) HardReset() {
 	w.cachedWantsToGetUp = w.WantsToGetUp()
-	if w.IntroductionPoints.IsEmpty() {
-		w.cachedLastDownload = nil
-	} else {
-		w.cachedLastDownload = w.IntroductionPoints.First.LastDownload
-	}
+	w.cachedNextRecrawl = w.NextRecrawl()
 
 	w.InMemory = false
 	w.IntroductionPoints = nil
@@ -192,18 +256,19 @@ func (w *Hostworker) MoveToMemory() {
 
 func (w *Hostworker) GetRecrawlDuration() time.Duration {
 	if !w.InMemory {
-		if w.cachedLastDownload == nil {
+		if w.cachedNextRecrawl == nil {
 			w.crawler.cfg.Log("error", "GetRecrawlDuration on worker with empty IntroductionPoints (disk)!")
 			return time.Minute * 5
 		}
-		return time.Hour*12 - time.Since(*w.cachedLastDownload)
+		return w.cachedNextRecrawl.Sub(time.Now())
 	}
 
-	if w.IntroductionPoints.IsEmpty() {
+	next := w.NextRecrawl()
+	if next == nil {
 		w.crawler.cfg.Log("error", "GetRecrawlDuration on worker with empty IntroductionPoints!")
 		return time.Minute * 5
 	}
-	return time.Hour*12 - time.Since(*w.IntroductionPoints.First.LastDownload)
+	return next.Sub(time.Now())
 }
 
 func NewHostworker(host string, crawler *Crawler) *Hostworker {
@@ -221,6 +286,15 @@ func NewHostworker(host string, crawler *Crawler) *Hostworker {
 		stop:       crawler.Stop,
 		crawler:    crawler,
 		InMemory:   true,
+
+		Traps:        NewTrapDetector(crawler.cfg.TrapSegmentRepeatLimit, crawler.cfg.TrapPatternLimit, crawler.cfg.TrapQueryVariantLimit, crawler.cfg.TrapDuplicateLimit, time.Duration(crawler.cfg.TrapQuarantineTime)*time.Minute),
+		RuleRejected: make(map[string]int),
+
+		SitemapsFetched: make(map[string]time.Time),
+		inFlight:        make(map[*CrawlItem]bool),
+		Limiter:         NewHostLimiter(crawler.cfg.HostRate, crawler.cfg.HostMinRate, crawler.cfg.HostMaxRate, crawler.cfg.HostBurst),
+		Value:           &HostValue{},
+		Budget:          &CrawlBudget{},
 	}
 
 	return w
@@ -271,6 +345,20 @@ func (w *Hostworker) WantsToGetUp() bool {
 		return false
 	}
 
+	// Retry-After loopt nog: de crawler parkeert de worker tot NotBefore
+	if !w.Limiter.Ready(time.Now()) {
+		return false
+	}
+
+	if w.BudgetExhausted() {
+		return false
+	}
+
+	return w.hasWork()
+}
+
+// Of de worker nog items heeft, los van limieten die hem tijdelijk tegenhouden
+func (w *Hostworker) hasWork() bool {
 	if !w.InMemory {
 		return w.cachedWantsToGetUp
 	}
@@ -278,6 +366,31 @@ func (w *Hostworker) WantsToGetUp() bool {
 	return w.wantsToGetUp()
 }
 
+// Tijdstip waarop een worker met items weer verder mag, nul als hij niet
+// op een tijdstip wacht. Een fail streak wacht op nieuwe links in plaats van op een tijdstip
+func (w *Hostworker) ParkedUntil(now time.Time) time.Time {
+	var until time.Time
+	if w.IsInFailTimeout() || !w.hasWork() {
+		return until
+	}
+
+	if !w.Limiter.Ready(now) {
+		until = w.Limiter.NotBefore
+	}
+
+	if w.BudgetExhausted() {
+		// Dagbudget: wakker maken als de volgende dag (UTC) begint
+		reset := w.Budget.DayResetsAt()
+		if reset.IsZero() {
+			return reset
+		}
+		if reset.After(until) {
+			until = reset
+		}
+	}
+	return until
+}
+
 func (w *Hostworker) wantsToGetUp() bool {
 	result := !w.PriorityQueue.IsEmpty() || !w.Queue.IsEmpty() || !w.LowPriorityQueue.IsEmpty()
 	if result {
@@ -312,6 +425,9 @@ func (w *Hostworker) Recrawl() {
 
 	w.LatestCycle++
 
+	// Wordt opnieuw opgebouwd met de pagina's van deze cycle
+	w.nextRecrawl = nil
+
 	if w.crawler.cfg.LogRecrawlingEnabled {
 		w.crawler.cfg.LogInfo("Recrawl initiated for " + w.String())
 	}
@@ -326,14 +442,21 @@ func (w *Hostworker) Recrawl() {
 }
 
 func (w *Hostworker) Run(client *http.Client) {
+	// Extra goroutines die tegelijk requests naar deze host uitvoeren
+	var requests sync.WaitGroup
+
 	defer func() {
 		if e := recover(); e != nil {
 			//log and so other stuff
 			w.crawler.cfg.Log("Panic", identifyPanic())
 		}
 
+		requests.Wait()
+		w.Budget.Stop(time.Now(), w.LatestCycle)
+
 		if w.InMemory {
 			w.EmptyPendingItems()
+			w.ReportStats()
 			w.MoveToDisk()
 		}
 
@@ -361,56 +484,196 @@ func (w *Hostworker) Run(client *http.Client) {
 		w.EmptyPendingItems()
 	}
 
+	w.Budget.Start(time.Now())
+	w.activeRequests = 1
+	w.requestLoop(&requests, true)
+}
+
+// Voert requests uit tot de queue leeg is of de worker moet stoppen. De toestand van
+// de worker (queues, AlreadyFound, items) wordt enkel aangepast met w.lock, die
+// enkel vrijgegeven wordt tijdens netwerkverkeer en het parsen. Zo kunnen meerdere
+// goroutines tegelijk requests naar dezelfde host uitvoeren.
+func (w *Hostworker) requestLoop(requests *sync.WaitGroup, main bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !main {
+		defer func() {
+			w.activeRequests--
+		}()
+	}
+
 	for {
 		select {
 		case <-w.stop:
 			return
 		case q := <-w.NewItems:
 			w.AddQueue(q)
-
+			continue
 		default:
-			item := w.GetNextRequest()
+		}
 
-			if item == nil {
-				// queue is leeg
-				return
-			}
+		if w.sleepAfter <= 0 {
+			// Meteen stoppen
+			return
+		}
 
-			w.RequestStarted(item)
-			w.Request(item)
+		if !w.Limiter.Ready(time.Now()) {
+			// Retry-After van de server
+			return
+		}
 
-			if w.sleepAfter <= 0 {
-				// Meteen stoppen
-				return
-			}
+		if w.BudgetExhausted() {
+			// Geparkeerd tot de volgende cycle of dag
+			return
+		}
 
-			time.Sleep(time.Millisecond * time.Duration(w.crawler.cfg.SleepTime+rand.Intn(w.crawler.cfg.SleepTimeRandom)))
+		target := w.TargetConcurrency()
+		if !main && w.activeRequests > target {
+			return
+		}
+
+		for main && w.activeRequests < target {
+			w.activeRequests++
+			requests.Add(1)
+			go func() {
+				defer requests.Done()
+				defer func() {
+					if e := recover(); e != nil {
+						w.crawler.cfg.Log("Panic", identifyPanic())
+					}
+				}()
+				w.requestLoop(requests, false)
+			}()
+		}
+
+		item := w.GetNextRequest()
+
+		if item == nil {
+			// queue is leeg
+			return
+		}
+
+		if w.inFlight[item] {
+			// Wordt al gedownload door een andere goroutine. Kan niet voorkomen
+			// omdat NewReference geen items in inFlight in een queue plaatst
+			continue
+		}
 
+		// Wachten tot de host een nieuwe request toelaat
+		if wait := w.Limiter.Take(time.Now()); wait > 0 {
+			w.unlocked(func() {
+				time.Sleep(wait)
+			})
 		}
+
+		w.inFlight[item] = true
+		w.RequestStarted(item)
+		w.Request(item)
+		delete(w.inFlight, item)
 	}
 }
 
+// Voert f uit zonder w.lock, voor netwerkverkeer en parsen
+func (w *Hostworker) unlocked(f func()) {
+	w.lock.Unlock()
+	defer w.lock.Lock()
+	f()
+}
+
+// Aantal requests die tegelijk naar deze host mogen lopen. Tussen HostConcurrency en
+// HostMaxConcurrency volgens de wet van Little: snelheid * latency
+func (w *Hostworker) TargetConcurrency() int {
+	min := w.crawler.cfg.HostConcurrency
+	if min < 1 {
+		min = 1
+	}
+	max := w.crawler.cfg.HostMaxConcurrency
+	if max <= min {
+		return min
+	}
+
+	if w.Limiter.Rate <= 0 {
+		return max
+	}
+
+	target := int(math.Ceil(w.Limiter.Rate * w.Limiter.Latency.Seconds()))
+	if target < min {
+		return min
+	}
+	if target > max {
+		return max
+	}
+	return target
+}
+
 func (w *Hostworker) Request(item *CrawlItem) {
 
 	// todo: . / .. splitten verwijderen in ResolveReference
 	// en misschien meteen string van maken?
 	reqUrl := item.Subdomain.Url.ResolveReference(item.URL)
 
+	// De blocklist kan gewijzigd zijn sinds het item in de queue kwam
+	if w.crawler.Blocklist.BlocksUrl(reqUrl) {
+		w.RequestIgnored(item)
+		return
+	}
+
+	w.CheckSitemaps(item.Subdomain)
+
+	if !w.CheckRobots(item) {
+		return
+	}
+
 	if w.crawler.cfg.LogRequests {
 		w.crawler.cfg.LogInfo("New request " + reqUrl.String())
 	}
 
 	if request, err := http.NewRequest("GET", reqUrl.String(), nil); err == nil {
-		request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; rv:45.0) Gecko/20100101 Firefox/45.0")
+		request.Header.Add("User-Agent", w.crawler.cfg.UserAgent)
 		request.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 		request.Header.Add("Accept_Language", "en-US,en;q=0.5")
+		request.Header.Add("Accept-Encoding", acceptEncoding)
 		request.Header.Add("Connection", "keep-alive")
 
+		// Conditionele recrawl: een 304 kost bijna geen bandbreedte. Als de queries
+		// veranderden hebben we de inhoud wel nodig
+		conditional := item.CanRevalidate() && w.crawler.QueryVersion != "" && item.QueryVersion == w.crawler.QueryVersion
+		if conditional {
+			if item.ETag != "" {
+				request.Header.Add("If-None-Match", item.ETag)
+			}
+			if item.LastModified != "" {
+				request.Header.Add("If-Modified-Since", item.LastModified)
+			}
+		}
+
 		//request.Close = true // Connectie weggooien
-		request = request.WithContext(w.crawler.context)
+		request = request.WithContext(distributors.WithRedirectFilter(w.crawler.context, func(u *url.URL) bool {
+			return !w.crawler.Blocklist.BlocksUrl(u)
+		}))
+
+		requestStart := time.Now()
 
-		if response, err := w.Client.Do(request); err == nil {
+		// Pas hier telt de pagina mee voor het budget, niet als het item eerder afgehandeld werd
+		w.Budget.AddPage(requestStart, w.LatestCycle)
+
+		var response *http.Response
+		w.unlocked(func() {
+			response, err = w.Client.Do(request)
+		})
+
+		if err == nil {
 			defer response.Body.Close()
+			w.TimeoutStreak = 0
+
+			if response.StatusCode == http.StatusNotModified && conditional {
+				w.Limiter.Success(time.Since(requestStart))
+				w.ThrottleStreak = 0
+				w.NotModified(item)
+				w.crawler.speedLogger.Log(time.Since(requestStart), 0)
+				return
+			}
 
 			if response.StatusCode < 200 || response.StatusCode >= 300 {
 				if w.crawler.cfg.LogNetwork {
@@ -418,13 +681,31 @@ func (w *Hostworker) Request(item *CrawlItem) {
 				}
 
 				// Special exceptions
-				if response.StatusCode == 429 {
-					w.crawler.cfg.Log("WARNING", "Too many requests for host "+w.String())
-					w.NewFailStreak()
+				now := time.Now()
+				retryAfter := parseRetryAfter(response.Header.Get("Retry-After"), now)
+
+				// Een 503 zonder Retry-After is een gewone fout
+				if response.StatusCode == 429 || (response.StatusCode == 503 && retryAfter > 0) {
+					w.Limiter.Throttle(now, retryAfter)
+					w.ThrottleStreak++
+					w.crawler.cfg.Log("WARNING", fmt.Sprintf("Too many requests for host %v (status %v, rate %.2f/s, retry after %v)", w.String(), response.StatusCode, w.Limiter.Rate, retryAfter))
+
+					if w.ThrottleStreak >= maxThrottleStreak {
+						// Blijft ons afremmen: host een tijd met rust laten
+						w.ThrottleStreak = 0
+						w.NewFailStreak()
+					} else if retryAfter > 0 {
+						// Later opnieuw proberen zonder dat het item faalt
+						item.FailCount--
+					}
 					w.RequestFailed(item)
 					return
 				}
 
+				if response.StatusCode >= 500 {
+					w.Limiter.Failure()
+				}
+
 				// ignore range: 400 - 406
 				if response.StatusCode >= 400 && response.StatusCode <= 406 {
 					if w.crawler.cfg.LogNetwork {
@@ -447,23 +728,29 @@ func (w *Hostworker) Request(item *CrawlItem) {
 				return
 			}
 
+			w.Limiter.Success(time.Since(requestStart))
+			w.ThrottleStreak = 0
 			startTime := time.Now()
 
-			// Maximaal 2MB (pagina's in darkweb zijn gemiddeld erg groot vanwege de afbeeldingen)
-			if response.ContentLength > maxFileSize {
-				//w.crawler.cfg.LogInfo("Response: Content too long")
-				// Too big
-				// Eventueel op een ignore list zetten
+			// Bytes over het netwerk (gecomprimeerd)
+			wire := NewCountingReader(w.crawler.Bandwidth.Reader(response.Body), math.MaxInt32)
+			var body io.Reader
+			w.unlocked(func() {
+				body, err = decodeContentEncoding(wire, response.Header.Get("Content-Encoding"))
+			})
+			if err != nil {
 				if w.crawler.cfg.LogNetwork {
-					w.crawler.cfg.Log("network", "file too big (content length) "+reqUrl.String())
+					w.crawler.cfg.Log("network", err.Error()+" "+reqUrl.String())
 				}
-
-				w.RequestIgnored(item)
+				w.RequestFailed(item)
 				return
 			}
 
-			// Eerste 512 bytes lezen om zo de contentType te bepalen
-			b, err := readFirstBytes(response.Body)
+			// Eerste bytes lezen om zo de contentType en charset te bepalen
+			var b []byte
+			w.unlocked(func() {
+				b, err = readFirstBytes(body, sniffLength)
+			})
 			if err != nil {
 				// Er ging iets mis
 				//w.crawler.cfg.LogError(err)
@@ -472,14 +759,37 @@ func (w *Hostworker) Request(item *CrawlItem) {
 			}
 
 			// Content type inlezen, als die niet goed zit stoppen...
-			contentType := http.DetectContentType(b)
-			//w.crawler.cfg.LogInfo("Detected Content-Type: " + contentType)
+			contentType := response.Header.Get("Content-Type")
+
+			mediaType := detectDocumentType(b, contentType, reqUrl.Path)
+			if mediaType == "" {
+				mediaType = detectMediaType(b, contentType)
+			}
 
-			if contentType != "text/html; charset=utf-8" {
-				//w.crawler.cfg.LogInfo("Not a HTML file")
+			handler := contentHandlers[mediaType]
+			if handler == nil || (isDocumentType(mediaType) && w.crawler.cfg.MaxDocumentSize <= 0) {
+				//w.crawler.cfg.LogInfo("Not a supported file")
 				// Op ignore list zetten
 				if w.crawler.cfg.LogNetwork {
-					w.crawler.cfg.Log("network", "not a html file "+reqUrl.String())
+					w.crawler.cfg.Log("network", "unsupported content type "+reqUrl.String())
+				}
+
+				w.RequestIgnored(item)
+				return
+			}
+
+			// Maximaal 2MB (pagina's in darkweb zijn gemiddeld erg groot vanwege de afbeeldingen)
+			maxSize := maxFileSize
+			if isDocumentType(mediaType) {
+				maxSize = w.crawler.cfg.MaxDocumentSize
+			}
+
+			if response.ContentLength > int64(maxSize) {
+				//w.crawler.cfg.LogInfo("Response: Content too long")
+				// Too big
+				// Eventueel op een ignore list zetten
+				if w.crawler.cfg.LogNetwork {
+					w.crawler.cfg.Log("network", "file too big (content length) "+reqUrl.String())
 				}
 
 				w.RequestIgnored(item)
@@ -489,11 +799,28 @@ func (w *Hostworker) Request(item *CrawlItem) {
 			firstReader := bytes.NewReader(b)
 
 			// De twee readers terug samenvoegen
-			reader := NewCountingReader(io.MultiReader(firstReader, response.Body), maxFileSize)
-			if w.ProcessResponse(item, response, reader) {
+			// maxSize telt gedecomprimeerde bytes, zo stoppen we compressie bommen
+			var full io.Reader = io.MultiReader(firstReader, body)
+
+			// Hash van het bestand voor de blocklist en om ongewijzigde pagina's te herkennen
+			contentHash := sha256.New()
+			full = io.TeeReader(full, contentHash)
+
+			var reader io.Reader = NewCountingReader(full, maxSize)
+
+			// Documenten zijn binair, de tekst wordt pas bij het uitlezen omgezet
+			charsetName := ""
+			if !isDocumentType(mediaType) {
+				enc, name := detectCharset(b, contentType)
+				charsetName = name
+				reader = decodeCharset(reader, enc, name)
+			}
+
+			if w.ProcessResponse(item, response, reader, handler, charsetName, contentHash) {
 				duration := time.Since(startTime)
-				w.crawler.speedLogger.Log(duration, reader.Size)
+				w.crawler.speedLogger.Log(duration, wire.Size)
 			}
+			w.Budget.AddBytes(wire.Size, time.Now(), w.LatestCycle)
 
 		} else {
 
@@ -501,43 +828,44 @@ func (w *Hostworker) Request(item *CrawlItem) {
 				response.Body.Close()
 			}
 
-			str := err.Error()
-			if w.crawler.cfg.LogNetwork {
-				w.crawler.cfg.Log("network", str)
+			kind := ClassifyNetworkError(err)
+			policy := networkErrorPolicies[kind]
+
+			// Geblokkeerde url's komen niet in de logs
+			if w.crawler.cfg.LogNetwork && kind != NetworkErrorRedirectBlocked {
+				w.crawler.cfg.Log("network", kind.String()+": "+err.Error())
+			}
+
+			if policy.Ignore {
+				w.RequestIgnored(item)
+				return
 			}
 
-			if strings.Contains(str, "SOCKS5") {
-				// Er is iets mis met de proxy,
-				// zal zich normaal uatomatisch herstellen, maar
-				// we stoppen even met deze crawler
+			if policy.StopWorker {
 				w.sleepAfter = -1
+			}
 
-			} else if strings.Contains(str, "Client.Timeout") {
+			if policy.Timeout {
 				if item.FailCount == 0 {
 					w.crawler.speedLogger.LogTimeout()
 				}
-			} else if strings.Contains(str, "timeout awaiting response headers") {
-				if item.FailCount == 0 {
-					w.crawler.speedLogger.LogTimeout()
-				}
-			} else if strings.Contains(str, "stopped after 10 redirects") {
-				w.RequestIgnored(item)
-				return
-			} else if strings.Contains(str, "server gave HTTP response to HTTPS client") {
+				w.Limiter.Failure()
+				w.TimeoutOccurred(reqUrl)
+			}
+
+			if policy.UseHTTP {
 				w.Scheme = "http"
 				item.Subdomain.Url.Scheme = "http"
-			} else if strings.Contains(str, "context canceled") {
-				// Negeer failcount bij handmatige cancel
+			}
+
+			if policy.Retry {
 				item.FailCount--
 				w.RequestFailed(item)
 				return
 			}
 
-			if item.FailCount == 0 {
-				w.FailCount++
-				if w.FailCount > 40 {
-					w.NewFailStreak()
-				}
+			if policy.HostFail {
+				w.HostFailed(item)
 			}
 
 			w.RequestFailed(item)
@@ -549,9 +877,13 @@ func (w *Hostworker) Request(item *CrawlItem) {
 
 }
 
-func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, reader io.Reader) bool {
-	// Doorgeven aan parser
-	result, err := Parse(reader, w.crawler.Queries, item.Depth < maxCrawlDepth)
+func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, reader io.Reader, handler ContentHandler, charsetName string, contentHash hash.Hash) bool {
+	// Eerst alles inlezen zodat de hash van de inhoud gekend is
+	var data []byte
+	var err error
+	w.unlocked(func() {
+		data, err = ioutil.ReadAll(reader)
+	})
 
 	if err != nil {
 		if err.Error() == "Reader reached maximum bytes!" {
@@ -566,23 +898,73 @@ func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, r
 		return false
 	}
 
+	sum := contentHash.Sum(nil)
+
+	// Inhoud op de blocklist: geen resultaten, indicators of links doorgeven
+	if w.crawler.Blocklist.BlocksContent(sum) {
+		w.RequestIgnored(item)
+		return false
+	}
+
+	// Ongewijzigde pagina: indicators niet opnieuw uitvoeren, links wel. De queries
+	// enkel als er sinds de vorige download queries bijkwamen of veranderden
+	hashString := hex.EncodeToString(sum[:contentHashSize])
+	// Items uit de SeenSet hebben enkel het begin van de hash en de versie
+	unchanged := item.ContentHash != "" && strings.HasPrefix(hashString, item.ContentHash)
+	queryList := w.crawler.Queries
+	version := w.crawler.QueryVersion
+	if unchanged {
+		if version != "" && item.QueryVersion != "" && strings.HasPrefix(version, item.QueryVersion) {
+			queryList = nil
+		}
+		w.crawler.speedLogger.LogUnchanged()
+	}
+
+	// Doorgeven aan parser
+	parseUrls := item.Depth < maxCrawlDepth
+	var result *ParseResult
+	w.unlocked(func() {
+		result, err = Parse(bytes.NewReader(data), handler, queryList, parseUrls)
+	})
+
+	if err != nil {
+		w.crawler.speedLogger.LogTimeout()
+		w.RequestFailed(item)
+		return false
+	}
+	result.Charset = charsetName
+
 	if response.Request.URL.Scheme == "https" {
 		w.Scheme = "https"
 	} else if response.Request.URL.Scheme == "http" {
 		w.Scheme = "http"
 	}
 
+	// Url voor eventuele redirects
+	requested := item.String()
+
+	// Enkel de eerste download van een url: een recrawl van dezelfde pagina is geen duplicaat
+	if item.LastDownload == nil {
+		w.logQuarantine(w.Traps.ContentSeen(item.URL, result.Lowercased))
+	}
+
 	// tijdelijk absolute url toelaten!!!!!! -> makeRelative(item.URL) noodzakelijk achteraan
 	item.URL = response.Request.URL
 
 	// Save results
+	if item.ContentHash != "" && !unchanged {
+		w.Value.Change()
+	}
+
 	if len(result.Results) > 0 {
+		w.Value.Result(len(result.Results))
 		host := w.String()
 		urlString := item.URL.String()
 
 		for _, apiResult := range result.Results {
 			apiResult.Host = &host
 			apiResult.Url = &urlString
+			apiResult.Charset = result.Charset
 			if apiResult.Title == nil {
 				apiResult.Title = &host
 			}
@@ -591,66 +973,64 @@ func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, r
 		}
 	}
 
-	workerResult := NewWorkerResult()
-
-	if result.Urls != nil {
-		for _, u := range result.Urls {
-			// Convert links to absolute url
-			ResolveReferenceNoCopy(response.Request.URL, u)
-
-			// Url moet absoluut zijn
-			if !u.IsAbs() {
-				panic("Resolve reference didn't make absolute")
-				continue
+	// Indicators (adressen, e-mails, sleutels...) opslaan
+	if w.crawler.cfg.ExtractIndicators && !unchanged {
+		indicators := ExtractIndicators(result.Visible)
+		if len(indicators) > 0 {
+			host := w.String()
+			urlString := item.URL.String()
+			title := result.Title
+			if title == nil {
+				title = &host
 			}
 
-			if !strings.HasPrefix(u.Scheme, "http") || len(u.Host) == 0 {
-				continue
+			for _, indicator := range indicators {
+				indicator.Host = &host
+				indicator.Url = &urlString
+				indicator.Title = title
 			}
 
-			// Host opspliten in subdomein en domein
-			domains := strings.Split(u.Host, ".")
-			if len(domains) < 2 {
-				continue
-			}
+			w.crawler.ApiController.SaveIndicators(indicators)
+		}
+	}
 
-			if w.crawler.cfg.OnlyOnion {
-				tld := domains[len(domains)-1]
-				if tld != "onion" {
-					continue
-				}
+	workerResult := NewWorkerResult()
 
-				domain := domains[len(domains)-2]
+	// Pagina waarop de links gevonden werden
+	source := response.Request.URL.String()
 
-				if len(domain) != 16 {
-					// todo: ondersteuning voor tor subdomains toevoegen!
-					// Ongeldig -> verwijder alle ongeldige characters (tor browser doet dit ook)
-					domain = onionRegexp.ReplaceAllString(domain, "")
-					if len(domain) != 16 {
-						continue
-					}
-					// Terug samenvoegen
-					domains[len(domains)-2] = domain
-					u.Host = strings.Join(domains, ".")
-				}
-			} else {
-				if len(domains[len(domains)-1]) < 2 {
-					// tld te kort
-					continue
-				}
+	// Relatieve links vertrekken van <base href> als die er is
+	base := response.Request.URL
+	if result.Base != nil {
+		resolved := response.Request.URL.ResolveReference(result.Base)
+		if strings.HasPrefix(resolved.Scheme, "http") && len(resolved.Host) > 0 {
+			base = resolved
+		}
+	}
 
-				if len(domains[len(domains)-2]) < 1 {
-					// domain te kort
-					continue
-				}
-			}
+	if result.Canonical != nil {
+		w.AddCanonicalAlias(item, base.ResolveReference(result.Canonical))
+	}
 
-			if w.crawler.GetDomainForUrl(domains) == w.Host {
-				// Interne URL's meteen verwerken
-				w.NewReference(u, item, true)
-			} else {
-				workerResult.Append(u)
-			}
+	links := make([]string, 0, len(result.Links))
+	stored := make(map[string]bool)
+	for _, link := range result.Links {
+		u := link.Url
+
+		// Convert links to absolute url
+		ResolveReferenceNoCopy(base, u)
+		w.crawler.Canonicalizer.Canonicalize(u)
+
+		// Url moet absoluut zijn
+		if !u.IsAbs() {
+			panic("Resolve reference didn't make absolute")
+			continue
+		}
+
+		// Spaties scheiden de links in SaveToString
+		if str := w.processLink(item, link, source, workerResult); str != "" && !stored[str] && !strings.ContainsAny(str, " \t\r\n") {
+			stored[str] = true
+			links = append(links, str)
 		}
 	}
 
@@ -677,7 +1057,7 @@ func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, r
 		}
 
 		// Doorgeven aan crawler en aan juiste worker bezorgen voor verdere afhandeling?
-		workerResult.Append(&cc)
+		workerResult.Append(&FoundLink{Url: &cc, Type: LinkTypeRedirect, Source: requested})
 		w.crawler.WorkerResult.stack(workerResult)
 
 		return false
@@ -691,10 +1071,106 @@ func (w *Hostworker) ProcessResponse(item *CrawlItem, response *http.Response, r
 		w.crawler.WorkerResult.stack(workerResult)
 	}
 
+	w.UpdateChangeInterval(item, !unchanged)
+
+	// Validators en links bijhouden voor de volgende recrawl. Links enkel voor
+	// pagina's die elke cycle opnieuw gecrawld worden, anders wordt het bestand te groot
+	item.ETag = cleanValidator(response.Header.Get("ETag"))
+	item.LastModified = cleanValidator(response.Header.Get("Last-Modified"))
+	item.ContentHash = hashString
+	item.QueryVersion = version
+	item.Links = nil
+	if item.Depth < maxRecrawlDepth && (item.ETag != "" || item.LastModified != "") {
+		item.Links = links
+	}
+
 	w.RequestFinished(item)
 	return true
 }
 
+// Controleert een absolute link en geeft die door aan deze worker of de crawler.
+// Geeft de (eventueel aangepaste) url terug, of een lege string als de link genegeerd wordt
+func (w *Hostworker) processLink(item *CrawlItem, link *FoundLink, source string, workerResult *WorkerResult) string {
+	u := link.Url
+
+	if !strings.HasPrefix(u.Scheme, "http") || len(u.Host) == 0 {
+		return ""
+	}
+
+	// Host opspliten in subdomein en domein
+	domains := strings.Split(u.Host, ".")
+	if len(domains) < 2 {
+		return ""
+	}
+
+	if w.crawler.cfg.OnlyOnion {
+		tld := domains[len(domains)-1]
+		if tld != "onion" {
+			return ""
+		}
+
+		domain := domains[len(domains)-2]
+
+		if !isValidOnionDomain(domain) {
+			// todo: ondersteuning voor tor subdomains toevoegen!
+			// Ongeldig -> verwijder alle ongeldige characters (tor browser doet dit ook)
+			domain = onionRegexp.ReplaceAllString(domain, "")
+			if !isValidOnionDomain(domain) {
+				return ""
+			}
+			// Terug samenvoegen
+			domains[len(domains)-2] = domain
+			u.Host = strings.Join(domains, ".")
+		}
+	} else {
+		if len(domains[len(domains)-1]) < 2 {
+			// tld te kort
+			return ""
+		}
+
+		if len(domains[len(domains)-2]) < 1 {
+			// domain te kort
+			return ""
+		}
+	}
+
+	str := u.String()
+	if w.crawler.GetDomainForUrl(domains) == w.Host {
+		// Interne URL's meteen verwerken
+		w.NewReference(u, item, true)
+	} else {
+		link.Source = source
+		workerResult.Append(link)
+	}
+	return str
+}
+
+// 304 op een conditionele recrawl: de links van de vorige download opnieuw verwerken
+func (w *Hostworker) NotModified(item *CrawlItem) {
+	if w.crawler.cfg.LogNetwork {
+		w.crawler.cfg.Log("network", "not modified "+item.String())
+	}
+	w.crawler.speedLogger.LogNotModified()
+	w.UpdateChangeInterval(item, false)
+
+	workerResult := NewWorkerResult()
+	source := item.String()
+
+	for _, str := range item.Links {
+		u, err := url.Parse(str)
+		if err != nil || !u.IsAbs() {
+			continue
+		}
+		w.processLink(item, &FoundLink{Url: u, Type: LinkTypeUnknown}, source, workerResult)
+	}
+
+	if len(workerResult.Links) > 0 {
+		w.crawler.WorkerResult.stack(workerResult)
+	}
+
+	w.RequestFinished(item)
+}
+
 func (w *Hostworker) RequestStarted(item *CrawlItem) {
 	w.sleepAfter--
 
@@ -711,6 +1187,7 @@ func (w *Hostworker) RequestFinished(item *CrawlItem) {
 	w.FailStreak = 0
 	w.LastFailStreak = nil
 	w.FailCount = 0
+	w.Value.Request()
 
 	if item.Depth == 0 {
 		// Introduction point toevoegen
@@ -739,6 +1216,8 @@ func (w *Hostworker) RequestFinished(item *CrawlItem) {
 	now := time.Now()
 	item.LastDownload = &now
 	item.LastDownloadStarted = nil
+
+	w.compactItem(item)
 }
 
 func (w *Hostworker) RequestIgnored(item *CrawlItem) {
@@ -747,6 +1226,7 @@ func (w *Hostworker) RequestIgnored(item *CrawlItem) {
 	}
 
 	item.Ignore = true
+	w.compactItem(item)
 }
 
 func (w *Hostworker) RequestFailed(item *CrawlItem) {
@@ -754,6 +1234,7 @@ func (w *Hostworker) RequestFailed(item *CrawlItem) {
 		w.crawler.cfg.LogInfo("Request failed" + item.URL.String())
 	}
 	item.FailCount++
+	w.Value.Failure()
 
 	if !item.IsUnavailable() {
 		// We wagen nog een poging binnen een uurtje
@@ -762,6 +1243,41 @@ func (w *Hostworker) RequestFailed(item *CrawlItem) {
 	}
 }
 
+// Na NewCircuitAfterTimeouts timeouts na elkaar proberen we een ander circuit,
+// een trage relay is vaak de oorzaak
+func (w *Hostworker) TimeoutOccurred(reqUrl *url.URL) {
+	w.TimeoutStreak++
+
+	max := w.crawler.cfg.NewCircuitAfterTimeouts
+	if max <= 0 || w.TimeoutStreak < max {
+		return
+	}
+	w.TimeoutStreak = 0
+
+	if w.crawler.cfg.LogNetwork {
+		w.crawler.cfg.Log("network", "new circuit for "+w.String())
+	}
+
+	// Praat met de control port van tor (tot 10s), zonder de andere requests op te houden
+	client := w.Client
+	host := reqUrl.Host
+	w.unlocked(func() {
+		w.crawler.distributor.NewCircuit(client, host)
+	})
+}
+
+// Telt een mislukte request mee voor de host (enkel de eerste poging van een item).
+// Na 40 fouten volgt een failstreak.
+func (w *Hostworker) HostFailed(item *CrawlItem) {
+	if item.FailCount > 0 {
+		return
+	}
+	w.FailCount++
+	if w.FailCount > 40 {
+		w.NewFailStreak()
+	}
+}
+
 func (w *Hostworker) NewFailStreak() {
 	w.FailCount = 0
 	w.FailStreak++
@@ -799,6 +1315,12 @@ func (w *Hostworker) GetNextRequest() *CrawlItem {
 }
 
 func cleanURLPath(u *url.URL) string {
+	if strings.Contains(u.RawQuery, ";") {
+		keyed := *u
+		keyed.RawQuery = queryKey(u.RawQuery)
+		u = &keyed
+	}
+
 	str := []byte(u.String())
 	if len(str) == 0 {
 		return string(str)
@@ -830,6 +1352,74 @@ func splitUrlRelative(absolute *url.URL) *url.URL {
 	return &domain
 }
 
+func (w *Hostworker) logQuarantine(pattern *queries.QuarantinedPattern) {
+	if pattern != nil {
+		w.crawler.cfg.Log("Trap", w.Host+" "+pattern.Pattern+" ("+pattern.Reason+")")
+	}
+}
+
+// Stuurt de statistieken van deze host door als er iets veranderd is
+func (w *Hostworker) ReportStats() {
+	if (!w.Traps.Changed() && len(w.RuleRejected) == 0 && w.Limiter.Throttled == 0 && w.ChangedPages == 0 && w.RecrawlSkipped == 0 && !w.crawler.cfg.HasBudget()) || w.crawler.cfg.Testing {
+		return
+	}
+
+	stats := queries.NewHostStats(w.Host)
+	for _, subdomain := range w.Subdomains {
+		stats.Items += len(subdomain.AlreadyFound) + subdomain.Seen.Len()
+		stats.Compacted += subdomain.Seen.Len()
+	}
+	w.Traps.FillStats(stats)
+
+	stats.Rate = w.Limiter.Rate
+	stats.Latency = int(w.Limiter.Latency / time.Millisecond)
+	stats.Throttled = w.Limiter.Throttled
+	w.Limiter.Throttled = 0
+
+	if w.crawler.cfg.HasBudget() {
+		stats.Budget = w.Budget.Stats()
+	}
+
+	stats.Changed = w.ChangedPages
+	stats.RecrawlSkipped = w.RecrawlSkipped
+	w.ChangedPages = 0
+	w.RecrawlSkipped = 0
+
+	if len(w.RuleRejected) > 0 {
+		stats.RuleRejected = w.RuleRejected
+		w.RuleRejected = make(map[string]int)
+	}
+
+	err := w.crawler.ApiController.SaveHostStats(stats)
+	if err != nil {
+		w.crawler.cfg.LogError(err)
+	}
+}
+
+// Links naar de canonieke url van een pagina verwijzen voortaan naar het item zelf
+func (w *Hostworker) AddCanonicalAlias(item *CrawlItem, canonical *url.URL) {
+	if item.Subdomain == nil || !canonical.IsAbs() {
+		return
+	}
+
+	w.crawler.Canonicalizer.Canonicalize(canonical)
+	if canonical.Host != item.Subdomain.Url.Host {
+		// Canonieke url op een ander subdomein of andere host negeren we
+		return
+	}
+
+	makeRelative(canonical)
+	key := cleanURLPath(canonical)
+	if _, found := item.Subdomain.AlreadyFound[key]; found {
+		return
+	}
+
+	if item.Subdomain.Aliases == nil {
+		item.Subdomain.Aliases = make(map[string]*CrawlItem)
+	}
+	item.Subdomain.Aliases[key] = item
+}
+
 func makeRelative(absolute *url.URL) {
 	absolute.Scheme = ""
 	absolute.Host = ""
@@ -848,6 +1438,15 @@ func (w *Hostworker) NewReference(foundUrl *url.URL, sourceItem *CrawlItem, inte
 	cc := *foundUrl
 	foundUrl = &cc
 
+	// Dezelfde pagina altijd onder dezelfde url bijhouden
+	if foundUrl.IsAbs() {
+		w.crawler.Canonicalizer.Canonicalize(foundUrl)
+
+		if w.crawler.Blocklist.BlocksUrl(foundUrl) {
+			return nil, nil
+		}
+	}
+
 	if w.IsInFailTimeout() {
 		// failStreak detecteren en referenties gewoon
 		// wegsmijten als we in timeout interval zitten
@@ -883,11 +1482,38 @@ func (w *Hostworker) NewReference(foundUrl *url.URL, sourceItem *CrawlItem, inte
 
 	if subdomainFound {
 		item, found = subdomain.AlreadyFound[uri]
+		if !found {
+			item, found = subdomain.Aliases[uri]
+		}
+
+		if !found {
+			item, found = w.lookupSeen(subdomain, uri, foundUrl, sourceItem, internal)
+			if found && item == nil {
+				// Al gecrawld, niet opnieuw nodig
+				return nil, nil
+			}
+		}
 	}
 
 	if !found {
+		depth := 0
+		if internal {
+			depth = sourceItem.Depth + 1
+		}
+
+		if rule := w.crawler.Rules.Check(w.Host, subdomain.Url.Host, foundUrl, depth); rule != "" {
+			w.RuleRejected[rule]++
+			return nil, nil
+		}
+
+		if !w.Traps.Allow(foundUrl) {
+			return nil, nil
+		}
+
 		item = NewCrawlItem(foundUrl)
+		w.Value.NewLink()
 		item.Subdomain = subdomain
+		w.logQuarantine(w.Traps.Added(foundUrl))
 
 		if internal {
 			item.Cycle = sourceItem.Cycle
@@ -941,11 +1567,12 @@ func (w *Hostworker) NewReference(foundUrl *url.URL, sourceItem *CrawlItem, inte
 		item.Remove()
 		w.PriorityQueue.Push(item)
 
-	} else if item.Queue == nil && (!found || (internal && item.Cycle < sourceItem.Cycle)) {
+	} else if item.Queue == nil && !w.inFlight[item] && (!found || (internal && item.Cycle < sourceItem.Cycle && w.RecrawlDue(item))) {
 		// Recrawl enkel toelaten als we dit item nog niet gevonden hebben
 		// of we hebben het wel al gevonden en het is een interne link afkomstig van een
 		// hogere cycle (recrawl). Externe links die we al gecrawled hebben
-		// negeren we, die staan in de introduction queue
+		// negeren we, die staan in de introduction queue.
+		// Een item dat nu gedownload wordt, komt na de request zelf terug in een queue als dat nodig is
 
 		if item.Depth < maxRecrawlDepth {
 			w.PriorityQueue.Push(item)
@@ -990,7 +1617,7 @@ func (w *Hostworker) ReadFromReader(reader *bufio.Reader) bool {
 	str := string(line)
 	parts := strings.Split(str, "\t")
 
-	if len(parts) == 6 {
+	if len(parts) == 6 || len(parts) == 8 {
 		w.Host = parts[0]
 		w.Scheme = parts[1]
 
@@ -1027,6 +1654,11 @@ func (w *Hostworker) ReadFromReader(reader *bufio.Reader) bool {
 		}
 		w.LatestCycle = num
 
+		if len(parts) == 8 {
+			w.DiscoveredVia = LinkTypeFromString(parts[6])
+			w.DiscoveredOn = parts[7]
+		}
+
 	} else if len(parts) == 5 {
 		// Compability without failStreak:
 		w.Host = parts[0]
@@ -1085,6 +1717,33 @@ func (w *Hostworker) ReadFromReader(reader *bufio.Reader) bool {
 		item := NewCrawlItemFromString(&str, subdomains)
 		if item == nil {
 			fmt.Println("Invalid item: " + str)
+		} else {
+			w.compactItem(item)
+		}
+		line, _, _ = reader.ReadLine()
+	}
+
+	// SeenSet per subdomein (ontbreekt in oudere bestanden)
+	line, _, _ = reader.ReadLine()
+	for len(line) > 0 {
+		index, hash, entry, ok := parseSeenEntry(string(line))
+		if !ok || index < 0 || index >= len(subdomains) {
+			fmt.Println("Invalid seen item: " + string(line))
+		} else {
+			subdomain := subdomains[index]
+			if subdomain.Seen == nil {
+				subdomain.Seen = NewSeenSet()
+			}
+			subdomain.Seen.addHash(hash, entry)
+		}
+		line, _, _ = reader.ReadLine()
+	}
+
+	// Patronen in quarantaine (ontbreekt in oudere bestanden)
+	line, _, _ = reader.ReadLine()
+	for len(line) > 0 {
+		if !w.Traps.ReadFromString(string(line)) {
+			fmt.Println("Invalid quarantined pattern: " + string(line))
 		}
 		line, _, _ = reader.ReadLine()
 	}
@@ -1093,13 +1752,15 @@ func (w *Hostworker) ReadFromReader(reader *bufio.Reader) bool {
 
 func (w *Hostworker) SaveToWriter(writer *bufio.Writer) {
 	str := fmt.Sprintf(
-		"%s	%s	%v	%v	%s	%v\n",
+		"%s	%s	%v	%v	%s	%v	%s	%s\n",
 		w.Host,
 		w.Scheme,
 		w.FailStreak,
 		w.FailCount,
 		TimeToString(w.LastFailStreak),
 		w.LatestCycle,
+		w.DiscoveredVia,
+		w.DiscoveredOn,
 	)
 	writer.WriteString(str)
 
@@ -1131,6 +1792,20 @@ func (w *Hostworker) SaveToWriter(writer *bufio.Writer) {
 			}
 		}
 	}
+	writer.WriteString("\n")
+
+	for _, subdomain := range w.Subdomains {
+		if subdomain.Seen == nil {
+			continue
+		}
+		index := subdomain.Index
+		subdomain.Seen.each(func(hash uint64, entry seenEntry) {
+			writer.WriteString(entry.format(index, hash))
+		})
+	}
+	writer.WriteString("\n")
+
+	w.Traps.SaveToWriter(writer)
 }
 
 func (w *Hostworker) IsEqual(b *Hostworker) bool {
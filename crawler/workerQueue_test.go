@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"github.com/SimonBackx/lantern-crawler/queries"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWorkerQueue(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	worker1 := NewHostworker("host1", crawler)
+	worker2 := NewHostworker("host2", crawler)
+	worker3 := NewHostworker("host3", crawler)
+	worker4 := NewHostworker("host4", crawler)
+
+	now := time.Now()
+	queue := NewWorkerQueue(30 * time.Minute)
+	queue.PushWithScore(worker1, 0, now)
+	queue.PushWithScore(worker2, 2, now.Add(10*time.Minute))
+
+	// Lang gewacht: ook een hoge score haalt worker1 niet meer in
+	queue.PushWithScore(worker3, maxHostScore, now.Add(10*time.Hour))
+	queue.PushWithScore(worker4, 0, now)
+
+	expected := []*Hostworker{worker2, worker1, worker4, worker3}
+	for _, worker := range expected {
+		if queue.Peek() != worker {
+			test.Logf("Expected %v first", worker.Host)
+			test.Fail()
+		}
+		if queue.Pop() != worker {
+			test.Logf("Popped wrong, expected %v", worker.Host)
+			test.Fail()
+		}
+	}
+
+	if !queue.IsEmpty() || queue.Pop() != nil {
+		test.Log("Queue should be empty")
+		test.Fail()
+	}
+
+	// Zonder aging: volgorde van aankomst
+	fifo := NewWorkerQueue(0)
+	fifo.PushWithScore(worker1, 0, now)
+	fifo.PushWithScore(worker2, maxHostScore, now)
+	if fifo.Pop() != worker1 || fifo.Length() != 1 {
+		test.Log("Queue without aging should be FIFO")
+		test.Fail()
+	}
+}
+
+func TestHostValue(test *testing.T) {
+	unknown := &HostValue{}
+	if unknown.Score(1) != unknownHostScore {
+		test.Logf("Unknown host score %v", unknown.Score(1))
+		test.Fail()
+	}
+
+	dead := &HostValue{Requests: 2, Failures: 40}
+	useful := &HostValue{Requests: 20, Results: 50, NewLinks: 10, Changes: 5}
+	if dead.Score(1) >= 1 || useful.Score(1) <= unknownHostScore || useful.Score(100) != maxHostScore {
+		test.Logf("Wrong scores: dead %v, useful %v", dead.Score(1), useful.Score(1))
+		test.Fail()
+	}
+
+	// Na een week telt alles nog maar half
+	start := time.Now()
+	useful.updated = start
+	useful.decay(start.Add(hostValueHalfLife))
+	if useful.Results != 25 || useful.Requests != 10 {
+		test.Logf("Wrong decay: %v results", useful.Results)
+		test.Fail()
+	}
+
+	rules, _ := NewRuleSet([]queries.CrawlRule{{Host: "forum.onion", Weight: 3}, {Exclude: []string{"^/logout"}}})
+	if rules.Weight("forum.onion") != 3 || rules.Weight("other.onion") != 1 {
+		test.Log("Wrong host weight")
+		test.Fail()
+	}
+}
+
+func TestParkedWorkers(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	worker := NewHostworker("test.com", crawler)
+	u, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(u, nil, false)
+
+	// Retry-After van 50ms: de worker mag niet meer opstaan
+	now := time.Now()
+	worker.Limiter.Throttle(now, 50*time.Millisecond)
+	if worker.WantsToGetUp() {
+		test.Log("Worker wants to get up during Retry-After")
+		test.Fail()
+	}
+
+	crawler.ParkWorker(worker)
+	crawler.ParkWorker(worker)
+	if crawler.ParkedWorkers.Length() != 1 {
+		test.Logf("Expected 1 parked worker, got %v", crawler.ParkedWorkers.Length())
+		test.Fail()
+	}
+
+	crawler.CheckParkedWorkers(now)
+	if crawler.SleepingCrawlers.Length() != 0 {
+		test.Log("Worker woken before Retry-After")
+		test.Fail()
+	}
+
+	select {
+	case <-crawler.WakeTimer:
+	case <-time.After(time.Second):
+		test.Log("Wake timer did not fire")
+		test.Fail()
+	}
+
+	crawler.CheckParkedWorkers(time.Now())
+	if crawler.SleepingCrawlers.Peek() != worker || !worker.Sleeping || crawler.ParkedWorkers.Length() != 0 {
+		test.Log("Worker not woken after Retry-After")
+		test.Fail()
+	}
+
+	// Een worker zonder items wordt niet geparkeerd
+	empty := NewHostworker("empty.com", crawler)
+	empty.Limiter.Throttle(time.Now(), time.Minute)
+	crawler.ParkWorker(empty)
+	if crawler.ParkedWorkers.Length() != 0 {
+		test.Log("Worker without items parked")
+		test.Fail()
+	}
+}
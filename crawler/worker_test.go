@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestWorkerDepth(test *testing.T) {
@@ -300,3 +305,249 @@ func BenchmarkLoadingFromFile(b *testing.B) {
 		file.Close()
 	}
 }
+
+func TestWorkerConcurrency(test *testing.T) {
+	var active, maxActive int32
+	var lock sync.Mutex
+	requested := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.URL.Path]++
+		lock.Unlock()
+
+		current := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if current <= max || atomic.CompareAndSwapInt32(&maxActive, max, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := 0; i < 20; i++ {
+				fmt.Fprintf(w, `<a href="/page%v">page</a>`, i)
+			}
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true, HostConcurrency: 4, SleepAfter: 1000})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+	worker.sleepAfter = 1000
+
+	worker.NewReference(serverUrl, nil, false)
+
+	var requests sync.WaitGroup
+	worker.activeRequests = 1
+	worker.requestLoop(&requests, true)
+	requests.Wait()
+
+	if len(requested) != 21 {
+		test.Logf("Expected 21 pages, got %v", len(requested))
+		test.Fail()
+	}
+	for path, count := range requested {
+		if count != 1 {
+			test.Logf("%v requested %v times", path, count)
+			test.Fail()
+		}
+	}
+	if maxActive < 2 || maxActive > 4 {
+		test.Logf("Expected between 2 and 4 concurrent requests, got %v", maxActive)
+		test.Fail()
+	}
+	if worker.activeRequests != 1 {
+		test.Logf("Active requests not released: %v", worker.activeRequests)
+		test.Fail()
+	}
+}
+
+func TestConditionalRecrawl(test *testing.T) {
+	var notModified, full int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Header().Set("ETag", `"v1"`)
+		}
+		fmt.Fprint(w, `<a href="/a">a</a>`)
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+
+	item, _ := worker.NewReference(serverUrl, nil, false)
+	request := func(item *CrawlItem) {
+		item.Remove()
+		worker.lock.Lock()
+		worker.Request(item)
+		worker.lock.Unlock()
+	}
+
+	request(item)
+	if item.ETag != `"v1"` || len(item.ContentHash) != 2*contentHashSize || len(item.Links) != 1 || item.Links[0] != server.URL+"/a" {
+		test.Logf("Validators not saved: %q %q %v", item.ETag, item.ContentHash, item.Links)
+		test.Fail()
+	}
+
+	// Opgeslagen en terug ingelezen item moet nog steeds conditioneel kunnen
+	str := item.SaveToString()
+	loaded := NewCrawlItemFromString(&str, nil)
+	if loaded == nil || loaded.ETag != item.ETag || loaded.ContentHash != item.ContentHash || loaded.QueryVersion != crawler.QueryVersion || !loaded.CanRevalidate() {
+		test.Logf("Validators lost after saving: %v", str)
+		test.Fail()
+	}
+
+	// Tweede keer: 304 en de links blijven gekend
+	a := worker.Subdomains[serverUrl.Host].AlreadyFound["/a"]
+	if a == nil {
+		test.Log("Link not found after first request")
+		test.Fail()
+		return
+	}
+	a.Cycle = -1
+	item.Cycle = 5
+
+	request(item)
+	if notModified != 1 || full != 1 || crawler.speedLogger.NotModified != 1 {
+		test.Logf("Expected one 304, got %v (full %v)", notModified, full)
+		test.Fail()
+	}
+	if a.Cycle != 5 {
+		test.Logf("Links of not modified page not processed, cycle %v", a.Cycle)
+		test.Fail()
+	}
+
+	// Zonder validators: volledige download, maar de queries worden overgeslagen
+	request(a)
+	request(a)
+	if full != 3 || crawler.speedLogger.Unchanged != 1 {
+		test.Logf("Unchanged content not detected: %v downloads, %v unchanged", full, crawler.speedLogger.Unchanged)
+		test.Fail()
+	}
+	if a.CanRevalidate() {
+		test.Log("Page without validators should not revalidate")
+		test.Fail()
+	}
+
+	// Nieuwe queries: de inhoud is opnieuw nodig, ook als die niet veranderde
+	crawler.QueryVersion = "new queries"
+	request(item)
+	request(a)
+	if full != 5 || notModified != 1 || item.QueryVersion != crawler.QueryVersion || a.QueryVersion != crawler.QueryVersion {
+		test.Logf("Pages not searched again after query change: %v downloads, %v not modified", full, notModified)
+		test.Fail()
+	}
+
+	request(item)
+	if notModified != 2 {
+		test.Log("No conditional request after queries were run")
+		test.Fail()
+	}
+}
+
+func TestThrottleResponses(test *testing.T) {
+	var status int32
+	var retryAfter atomic.Value
+	retryAfter.Store("")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := retryAfter.Load().(string); value != "" {
+			w.Header().Set("Retry-After", value)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	serverUrl, _ := url.Parse(server.URL)
+	worker := NewHostworker(crawler.GetDomainForUrl(strings.Split(serverUrl.Host, ".")), crawler)
+	worker.Client = &http.Client{}
+
+	item, _ := worker.NewReference(serverUrl, nil, false)
+	request := func(code int32, header string) {
+		atomic.StoreInt32(&status, code)
+		retryAfter.Store(header)
+		item.Remove()
+		worker.lock.Lock()
+		worker.Request(item)
+		worker.lock.Unlock()
+	}
+
+	// 503 zonder Retry-After telt als gewone fout
+	request(503, "")
+	if item.FailCount != 1 {
+		test.Logf("503 without Retry-After not counted, fail count %v", item.FailCount)
+		test.Fail()
+	}
+
+	// Met Retry-After enkel afremmen
+	request(503, "1")
+	request(429, "1")
+	if item.FailCount != 1 || worker.Limiter.Throttled != 2 {
+		test.Logf("Retry-After counted as failure, fail count %v", item.FailCount)
+		test.Fail()
+	}
+
+	// 429 zonder Retry-After telt wel
+	request(429, "")
+	if item.FailCount != 2 {
+		test.Logf("429 without Retry-After not counted, fail count %v", item.FailCount)
+		test.Fail()
+	}
+
+	// Blijven afremmen eindigt in een failstreak
+	for i := 0; i < maxThrottleStreak; i++ {
+		request(429, "1")
+	}
+	if worker.FailStreak != 1 {
+		test.Log("Repeated 429 responses did not start a fail streak")
+		test.Fail()
+	}
+}
+
+func TestInFlightReference(test *testing.T) {
+	crawler := NewCrawler(&CrawlerConfig{Testing: true})
+	worker := NewHostworker("test.com", crawler)
+	u, _ := url.Parse("http://www.test.com/")
+	worker.NewReference(u, nil, false)
+
+	item := worker.GetNextRequest()
+	worker.inFlight[item] = true
+
+	// Link uit een nieuwere cycle terwijl het item gedownload wordt
+	other, _ := url.Parse("http://www.test.com/other")
+	source, _ := worker.NewReference(other, item, true)
+	source.Cycle = item.Cycle + 1
+
+	again, _ := url.Parse("http://www.test.com/")
+	if found, _ := worker.NewReference(again, source, true); found != item || item.Queue != nil {
+		test.Log("Item queued again while in flight")
+		test.Fail()
+	}
+
+	// Na de request mag een nieuwere cycle het item wel opnieuw in de queue zetten
+	delete(worker.inFlight, item)
+	item.Cycle = source.Cycle - 1
+	again, _ = url.Parse("http://www.test.com/")
+	worker.NewReference(again, source, true)
+	if item.Queue == nil {
+		test.Log("Item not queued for recrawl after its request")
+		test.Fail()
+	}
+}
@@ -1,8 +1,12 @@
 package distributors
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"github.com/SimonBackx/lantern-crawler/queries"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -13,6 +17,36 @@ type Distributor interface {
 	IncreaseClients()
 	AvailableClients() int
 	UsedClients() int
+
+	// Volgende requests van deze client naar host over een nieuwe route laten verlopen
+	NewCircuit(client *http.Client, host string)
+
+	// Statistieken per client sinds de vorige oproep
+	CollectClientStats() []*queries.ClientStats
+}
+
+// Wordt teruggegeven (verpakt in een *url.Error) als een request te veel redirects volgt
+var ErrTooManyRedirects = errors.New("stopped after 10 redirects")
+
+// Wordt teruggegeven (verpakt in een *url.Error) als de filter van de request een redirect weigert
+var ErrRedirectBlocked = errors.New("redirect blocked")
+
+type redirectFilterKey struct{}
+
+// Context waarbij CheckRedirect elke redirect eerst aan filter voorlegt.
+// Redirects nemen de context van de oorspronkelijke request over.
+func WithRedirectFilter(ctx context.Context, filter func(u *url.URL) bool) context.Context {
+	return context.WithValue(ctx, redirectFilterKey{}, filter)
+}
+
+func CheckRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return ErrTooManyRedirects
+	}
+	if filter, ok := request.Context().Value(redirectFilterKey{}).(func(u *url.URL) bool); ok && !filter(request.URL) {
+		return ErrRedirectBlocked
+	}
+	return nil
 }
 
 type Clearnet struct {
@@ -33,8 +67,9 @@ func NewClearnet(count, max, headerTimeout, requestTimeout int) *Clearnet {
 	}
 
 	client := &http.Client{
-		Timeout:   time.Duration(requestTimeout) * time.Second,
-		Transport: tr,
+		Timeout:       time.Duration(requestTimeout) * time.Second,
+		Transport:     tr,
+		CheckRedirect: CheckRedirect,
 	}
 	return &Clearnet{Client: client, Count: count, MaxCount: max}
 }
@@ -52,6 +87,16 @@ func (dist *Clearnet) FreeClient(client *http.Client) {
 	dist.Used--
 }
 
+func (dist *Clearnet) NewCircuit(client *http.Client, host string) {
+	// Geen circuits op het clearnet
+}
+
+func (dist *Clearnet) CollectClientStats() []*queries.ClientStats {
+	return []*queries.ClientStats{
+		&queries.ClientStats{Address: "clearnet", Healthy: true, Workers: dist.Used},
+	}
+}
+
 func (dist *Clearnet) DecreaseClients() {
 	if dist.Count < 10 {
 		return
@@ -0,0 +1,176 @@
+package distributors
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimale client voor het tor control protocol (control-spec.txt)
+type TorControl struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func DialTorControl(address string, timeout time.Duration) (*TorControl, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	return &TorControl{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *TorControl) Close() error {
+	return c.conn.Close()
+}
+
+// Authenticeren met een cookie bestand (CookieAuthentication 1) of
+// een wachtwoord (HashedControlPassword). Zonder beide wordt een lege AUTHENTICATE verstuurd.
+func (c *TorControl) Authenticate(cookieFile, password string) error {
+	if len(cookieFile) > 0 {
+		cookie, err := ioutil.ReadFile(cookieFile)
+		if err != nil {
+			return err
+		}
+		_, err = c.Command("AUTHENTICATE " + hex.EncodeToString(cookie))
+		return err
+	}
+
+	if len(password) > 0 {
+		_, err := c.Command("AUTHENTICATE " + strconv.Quote(password))
+		return err
+	}
+
+	_, err := c.Command("AUTHENTICATE")
+	return err
+}
+
+// Verstuurt een commando en geeft de regels van een succesvol (250) antwoord terug
+func (c *TorControl) Command(command string) ([]string, error) {
+	if _, err := c.conn.Write([]byte(command + "\r\n")); err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, 1)
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if len(line) < 4 {
+			return nil, errors.New("tor control: invalid reply " + line)
+		}
+
+		if line[:3] != "250" {
+			return nil, errors.New("tor control: " + line)
+		}
+
+		lines = append(lines, line[4:])
+
+		if line[3] == '+' {
+			// Data antwoord: loopt door tot een regel met enkel een punt
+			for {
+				data, err := c.reader.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				data = strings.TrimRight(data, "\r\n")
+				if data == "." {
+					break
+				}
+				lines = append(lines, strings.TrimPrefix(data, "."))
+			}
+			continue
+		}
+
+		if line[3] == ' ' {
+			// Laatste regel
+			return lines, nil
+		}
+	}
+}
+
+func (c *TorControl) GetInfo(key string) (string, error) {
+	lines, err := c.Command("GETINFO " + key)
+	if err != nil {
+		return "", err
+	}
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+"=") {
+			value := line[len(key)+1:]
+			if len(value) == 0 && i+1 < len(lines) {
+				// Waarde over meerdere regels
+				value = strings.Join(lines[i+1:len(lines)-1], "\n")
+			}
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("tor control: %v not in reply", key)
+}
+
+func (c *TorControl) Signal(signal string) error {
+	_, err := c.Command("SIGNAL " + signal)
+	return err
+}
+
+// Geeft het bootstrap percentage terug (100 = klaar)
+func (c *TorControl) BootstrapProgress() (int, error) {
+	phase, err := c.GetInfo("status/bootstrap-phase")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, field := range strings.Fields(phase) {
+		if strings.HasPrefix(field, "PROGRESS=") {
+			return strconv.Atoi(field[len("PROGRESS="):])
+		}
+	}
+	return 0, errors.New("tor control: bootstrap progress not found in " + phase)
+}
+
+func (c *TorControl) CircuitEstablished() (bool, error) {
+	established, err := c.GetInfo("status/circuit-established")
+	if err != nil {
+		return false, err
+	}
+	return established == "1", nil
+}
+
+// Sluit alle circuits waarover momenteel een stream loopt naar een adres
+// waarvoor match true geeft. Geeft het aantal gesloten circuits terug.
+func (c *TorControl) CloseCircuits(match func(target string) bool) (int, error) {
+	status, err := c.GetInfo("stream-status")
+	if err != nil {
+		return 0, err
+	}
+
+	closed := make(map[string]bool)
+	for _, line := range strings.Split(status, "\n") {
+		// StreamID SP StreamStatus SP CircuitID SP Target
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] == "0" || closed[fields[2]] {
+			continue
+		}
+
+		if !match(fields[3]) {
+			continue
+		}
+
+		if _, err := c.Command("CLOSECIRCUIT " + fields[2]); err != nil {
+			return len(closed), err
+		}
+		closed[fields[2]] = true
+	}
+	return len(closed), nil
+}
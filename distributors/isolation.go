@@ -0,0 +1,21 @@
+package distributors
+
+import (
+	"net"
+	"strings"
+)
+
+// Sleutel waarop we tor streams isoleren: het domein zonder subdomeinen
+// zodat elke host zijn eigen circuits krijgt (IsolateSOCKSAuth)
+func isolationKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	labels := strings.Split(strings.ToLower(host), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,87 @@
+package distributors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Adres van een SOCKS5 proxy, eventueel met authenticatie
+type SocksEndpoint struct {
+	Address  string
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+
+	// Optionele control port, nodig om bootstrap status en circuits op te volgen
+	ControlAddress    string `json:",omitempty"`
+	ControlPassword   string `json:",omitempty"`
+	ControlCookieFile string `json:",omitempty"`
+}
+
+func (e SocksEndpoint) String() string {
+	return e.Address
+}
+
+// Voert een SOCKS5 handshake uit (zonder connect) om te controleren
+// of de proxy bereikbaar is en onze authenticatie aanvaardt.
+func checkSocksEndpoint(endpoint SocksEndpoint, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", endpoint.Address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	method := byte(0x00)
+	if len(endpoint.Username) > 0 {
+		method = 0x02
+	}
+
+	if _, err := conn.Write([]byte{0x05, 0x01, method}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[0] != 0x05 {
+		return fmt.Errorf("unexpected SOCKS version %v", reply[0])
+	}
+
+	if reply[1] != method {
+		return errors.New("SOCKS5 authentication method not accepted")
+	}
+
+	if method != 0x02 {
+		return nil
+	}
+
+	// Username / password authenticatie (RFC 1929)
+	if len(endpoint.Username) > 255 || len(endpoint.Password) > 255 {
+		return errors.New("SOCKS5 username or password too long")
+	}
+
+	b := make([]byte, 0, 3+len(endpoint.Username)+len(endpoint.Password))
+	b = append(b, 0x01, byte(len(endpoint.Username)))
+	b = append(b, endpoint.Username...)
+	b = append(b, byte(len(endpoint.Password)))
+	b = append(b, endpoint.Password...)
+
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[1] != 0x00 {
+		return errors.New("SOCKS5 authentication failed")
+	}
+
+	return nil
+}
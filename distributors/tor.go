@@ -2,101 +2,470 @@ package distributors
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/SimonBackx/lantern-crawler/queries"
 	"golang.org/x/net/proxy"
 	"io/ioutil"
 	"math"
+	"net"
 	"net/http"
 	"os/exec"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// Na zoveel mislukte controles na elkaar herstarten we een eigen daemon
+const maxDaemonFailures = 3
+
+type TorDaemon struct {
+	Endpoint SocksEndpoint
+	Client   *http.Client
+
+	// Enkel ingesteld als de crawler de daemon zelf opstartte
+	Process *TorProcess
+
+	Healthy      bool // Of de daemon in de rotatie zit
+	Bootstrapped int  // Laatst gekende bootstrap percentage
+	Failures     int  // Aantal mislukte controles na elkaar
+	Restarts     int
+
+	// Belasting (enkel aanpassen met de mutex van Tor)
+	Workers   int           // Aantal workers die deze client gebruiken
+	InFlight  int           // Aantal requests die op dit moment lopen
+	Latency   time.Duration // Voortschrijdend gemiddelde tot de response headers
+	ErrorRate float64       // Voortschrijdend gemiddelde van mislukte requests (0 - 1)
+
+	// Tellers sinds de laatste CollectClientStats
+	Requests int
+	Errors   int
+}
+
+func (d *TorDaemon) String() string {
+	return d.Endpoint.String()
+}
+
 type Tor struct {
-	Clients  *ClientList
+	Daemons  []*TorDaemon
 	Count    int
 	MaxCount int
 	Used     int
+
+	// Tijd die een daemon krijgt om te bootstrappen voor we die herstarten
+	BootstrapTimeout time.Duration
+
+	// Elke host krijgt eigen SOCKS credentials zodat tor aparte circuits gebruikt.
+	// Het wachtwoord is de generatie van de host, die verhoogd wordt bij NewCircuit
+	IsolateHosts bool
+	generations  map[string]int
+
+	// Selectie van de daemon bij GetClient: "least-loaded" of "latency"
+	Selection string
+
+	mutex sync.Mutex
 }
 
-func NewTor(daemons, count, max, headerTimeout, requestTimeout int) *Tor {
+func NewTor(daemons, count, max, headerTimeout, requestTimeout, healthInterval, bootstrapTimeout int, isolateHosts bool, selection string) *Tor {
 	startSocksPort := 9150
 	availableDaemons := daemons
-	run("kill", "$(pgrep tor)")
 
-	Clients := NewClientList()
+	// Achtergebleven daemons van een vorige run bezetten onze poorten
+	run("pkill", "-x", "tor")
+
+	processes := make([]*TorProcess, 0, availableDaemons)
 	for i := 0; i < availableDaemons; i++ {
-		addr := fmt.Sprintf("%v", startSocksPort+i)
-		addr2 := fmt.Sprintf("%v", startSocksPort+i+availableDaemons)
-		dir := fmt.Sprintf("/progress/tor_dir/tor%v", i)
+		process := NewTorProcess(startSocksPort+i, startSocksPort+i+availableDaemons, fmt.Sprintf("/progress/tor_dir/tor%v", i))
+
+		if err := process.Start(); err != nil {
+			fmt.Println("ERROR LAUNCHING tor: " + err.Error())
+		}
+		processes = append(processes, process)
+	}
 
-		run("mkdir", "-p", dir)
-		err := run("tor",
-			"--RunAsDaemon", "1",
-			"--SocksPort", addr,
-			"--ControlPort", addr2,
-			"--DataDirectory", dir,
+	dist := newTor(count, max, bootstrapTimeout, isolateHosts, selection)
+	for _, process := range processes {
+		dist.addDaemon(process.Endpoint(), process, headerTimeout, requestTimeout)
+	}
 
-			// Random password to disable control port access
-			"--HashedControlPassword", "16:118E516CCAA79CF76014434BD85092BE8E34C6D0D7594C2F5D4093F78B",
+	// Wachten tot de daemons gebootstrapt zijn
+	dist.WaitForBootstrap()
+	dist.startSupervisor(healthInterval)
+	return dist
+}
 
-			// Disable routing
-			"--ClientOnly", "1",
-			//"--MaxCircuitDirtiness", "300", // Maximum seconden om tor circuit te hergebruiken
-			//"--OnionTrafficOnly", "1", (unsupported)
-			//"--SafeSocks", "1", // Voorkom dns leaks (aanvragen met al geresolvede dns worden genegeerd)
-		)
+// Gebruik SOCKS5 proxies die buiten de crawler beheerd worden (bv. tor sidecar containers)
+// in plaats van zelf tor daemons op te starten
+func NewTorFromEndpoints(endpoints []SocksEndpoint, count, max, headerTimeout, requestTimeout, healthInterval, bootstrapTimeout int, isolateHosts bool, selection string) *Tor {
+	dist := newTor(count, max, bootstrapTimeout, isolateHosts, selection)
+	for _, endpoint := range endpoints {
+		dist.addDaemon(endpoint, nil, headerTimeout, requestTimeout)
+	}
 
-		//tor --RunAsDaemon 1 --SocksPort 9150 --ControlPort 9180 --DataDirectory "/tor_dir/tor1" --HashedControlPassword "16:118E516CCAA79CF76014434BD85092BE8E34C6D0D7594C2F5D4093F78B" --ClientOnly 1
+	dist.Supervise()
+	dist.startSupervisor(healthInterval)
+	return dist
+}
 
-		if err != nil {
-			fmt.Println("ERROR LAUNCHING tor: " + err.Error())
+func newTor(count, max, bootstrapTimeout int, isolateHosts bool, selection string) *Tor {
+	return &Tor{
+		Daemons:          make([]*TorDaemon, 0),
+		Count:            count,
+		MaxCount:         max,
+		BootstrapTimeout: time.Duration(bootstrapTimeout) * time.Second,
+		IsolateHosts:     isolateHosts,
+		Selection:        selection,
+		generations:      make(map[string]int),
+	}
+}
+
+func (dist *Tor) addDaemon(endpoint SocksEndpoint, process *TorProcess, headerTimeout, requestTimeout int) {
+	daemon := &TorDaemon{Endpoint: endpoint, Process: process}
+	client, err := dist.newSocksClient(daemon, headerTimeout, requestTimeout)
+	if err != nil {
+		fmt.Println("Proxy error " + err.Error())
+		return
+	}
+	daemon.Client = client
+	dist.Daemons = append(dist.Daemons, daemon)
+}
+
+func (dist *Tor) startSupervisor(interval int) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		for range ticker.C {
+			dist.Supervise()
+		}
+	}()
+}
+
+func (dist *Tor) newSocksClient(daemon *TorDaemon, headerTimeout, requestTimeout int) (*http.Client, error) {
+	endpoint := daemon.Endpoint
+	var auth *proxy.Auth
+	if len(endpoint.Username) > 0 {
+		auth = &proxy.Auth{User: endpoint.Username, Password: endpoint.Password}
+	}
+
+	torDialer, err := proxy.SOCKS5("tcp", endpoint.Address, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+
+	dial := torDialer.Dial
+	if dist.IsolateHosts && auth == nil {
+		dial = func(network, addr string) (net.Conn, error) {
+			dialer, err := proxy.SOCKS5("tcp", endpoint.Address, dist.isolationAuth(addr), proxy.Direct)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.Dial(network, addr)
 		}
+	}
+
+	transport := &http.Transport{
+		Dial:         dial,
+		MaxIdleConns: 500,
+		//DisableKeepAlives: true, // Hmmm?
+		/*TLSHandshakeTimeout:   10 * time.Second,
+		  MaxIdleConnsPerHost:   0,
+		  ResponseHeaderTimeout: 10 * time.Second,*/
+		ResponseHeaderTimeout: time.Duration(headerTimeout) * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true}, // Onveilige https toelaten
+	}
+
+	return &http.Client{
+		Transport:     &trackingTransport{dist: dist, daemon: daemon, transport: transport},
+		Timeout:       time.Duration(requestTimeout) * time.Second,
+		CheckRedirect: CheckRedirect,
+	}, nil
+}
+
+func (dist *Tor) isolationAuth(addr string) *proxy.Auth {
+	key := isolationKey(addr)
+
+	dist.mutex.Lock()
+	generation := dist.generations[key]
+	dist.mutex.Unlock()
+
+	return &proxy.Auth{User: key, Password: strconv.Itoa(generation)}
+}
+
+// Zorgt dat volgende requests naar host over een nieuw circuit verlopen.
+// Met host isolatie krijgt de host nieuwe SOCKS credentials en sluiten we de circuits
+// die nog streams naar deze host hebben. Zonder isolatie rest enkel NEWNYM.
+func (dist *Tor) NewCircuit(client *http.Client, host string) {
+	key := isolationKey(host)
 
-		torDialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("127.0.0.1:%v", addr), nil, proxy.Direct)
+	dist.mutex.Lock()
+	daemon := dist.daemonForClient(client)
+	if dist.IsolateHosts {
+		dist.generations[key]++
+	}
+	dist.mutex.Unlock()
+
+	if daemon == nil {
+		return
+	}
+
+	if transport, ok := client.Transport.(*trackingTransport); ok {
+		// Bestaande keep-alive verbindingen lopen nog over het oude circuit
+		transport.CloseIdleConnections()
+	}
 
+	if len(daemon.Endpoint.ControlAddress) == 0 {
+		return
+	}
+
+	control, err := DialTorControl(daemon.Endpoint.ControlAddress, 10*time.Second)
+	if err != nil {
+		fmt.Println("Tor control error: " + err.Error())
+		return
+	}
+	defer control.Close()
+
+	if err := control.Authenticate(daemon.Endpoint.ControlCookieFile, daemon.Endpoint.ControlPassword); err != nil {
+		fmt.Println("Tor control error: " + err.Error())
+		return
+	}
+
+	if !dist.IsolateHosts {
+		// Alle hosts op deze daemon krijgen een nieuw circuit
+		if err := control.Signal("NEWNYM"); err != nil {
+			fmt.Println("Tor control error: " + err.Error())
+		}
+		return
+	}
+
+	_, err = control.CloseCircuits(func(target string) bool {
+		return isolationKey(target) == key
+	})
+	if err != nil {
+		fmt.Println("Tor control error: " + err.Error())
+	}
+}
+
+// Blijft controleren tot alle daemons gebootstrapt zijn, of tot BootstrapTimeout verstreken is
+func (dist *Tor) WaitForBootstrap() {
+	deadline := time.Now().Add(dist.BootstrapTimeout)
+	for {
+		dist.Supervise()
+
+		if dist.HealthyDaemons() == len(dist.Daemons) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			fmt.Printf("%v of %v tor daemons bootstrapped\n", dist.HealthyDaemons(), len(dist.Daemons))
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (dist *Tor) HealthyDaemons() int {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
+	count := 0
+	for _, daemon := range dist.Daemons {
+		if daemon.Healthy {
+			count++
+		}
+	}
+	return count
+}
+
+// Controleert alle daemons. Daemons die falen worden uit de rotatie gehaald tot ze terug
+// gezond zijn. Eigen daemons die gestopt zijn of blijven falen worden herstart.
+func (dist *Tor) Supervise() {
+	for _, daemon := range dist.Daemons {
+		progress, err := dist.checkDaemon(daemon)
+
+		dist.mutex.Lock()
+		if err != nil && daemon.Healthy {
+			fmt.Println("Tor daemon " + daemon.String() + " taken out of rotation: " + err.Error())
+		} else if err == nil && !daemon.Healthy {
+			fmt.Println("Tor daemon " + daemon.String() + " in rotation")
+		}
+
+		daemon.Healthy = (err == nil)
+		daemon.Bootstrapped = progress
 		if err != nil {
-			fmt.Println("Proxy error" + err.Error())
+			daemon.Failures++
+		} else {
+			daemon.Failures = 0
 		}
 
-		transport := &http.Transport{
-			Dial:         torDialer.Dial,
-			MaxIdleConns: 500,
-			//DisableKeepAlives: true, // Hmmm?
-			/*TLSHandshakeTimeout:   10 * time.Second,
-			  MaxIdleConnsPerHost:   0,
-			  ResponseHeaderTimeout: 10 * time.Second,*/
-			ResponseHeaderTimeout: time.Duration(headerTimeout) * time.Second,
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true}, // Onveilige https toelaten
+		restart := false
+		if daemon.Process != nil {
+			if daemon.Process.Exited() {
+				restart = true
+			} else if daemon.Failures >= maxDaemonFailures && time.Since(daemon.Process.StartedAt) > dist.BootstrapTimeout {
+				restart = true
+			}
+		}
+		dist.mutex.Unlock()
+
+		if restart {
+			fmt.Println("Restarting tor daemon " + daemon.String())
+			if err := daemon.Process.Restart(); err != nil {
+				fmt.Println("ERROR LAUNCHING tor: " + err.Error())
+			}
+
+			dist.mutex.Lock()
+			daemon.Failures = 0
+			daemon.Restarts++
+			dist.mutex.Unlock()
 		}
-		Clients.Push(&http.Client{
-			Transport: transport,
-			Timeout:   time.Duration(requestTimeout) * time.Second,
-		})
 	}
+}
 
-	// Wachten
-	time.Sleep(10 * time.Second)
+// Geeft het bootstrap percentage terug en een error als de daemon niet bruikbaar is
+func (dist *Tor) checkDaemon(daemon *TorDaemon) (int, error) {
+	if daemon.Process != nil && daemon.Process.Exited() {
+		return 0, errors.New("process exited")
+	}
+
+	if err := checkSocksEndpoint(daemon.Endpoint, 10*time.Second); err != nil {
+		return 0, err
+	}
+
+	if len(daemon.Endpoint.ControlAddress) == 0 {
+		// Geen control port: SOCKS handshake moet volstaan
+		return 100, nil
+	}
+
+	control, err := DialTorControl(daemon.Endpoint.ControlAddress, 10*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer control.Close()
+
+	if err := control.Authenticate(daemon.Endpoint.ControlCookieFile, daemon.Endpoint.ControlPassword); err != nil {
+		return 0, err
+	}
+
+	progress, err := control.BootstrapProgress()
+	if err != nil {
+		return 0, err
+	}
+
+	if progress < 100 {
+		return progress, fmt.Errorf("bootstrapping (%v%%)", progress)
+	}
 
-	return &Tor{Clients: Clients, Count: count, MaxCount: max}
+	established, err := control.CircuitEstablished()
+	if err != nil {
+		return progress, err
+	}
+
+	if !established {
+		return progress, errors.New("no circuit established")
+	}
+
+	return progress, nil
+}
+
+func (dist *Tor) daemonForClient(client *http.Client) *TorDaemon {
+	for _, daemon := range dist.Daemons {
+		if daemon.Client == client {
+			return daemon
+		}
+	}
+	return nil
+}
+
+// Hoe lager, hoe liever we deze daemon gebruiken
+func (dist *Tor) load(daemon *TorDaemon) float64 {
+	if dist.Selection == "least-loaded" {
+		// Latency enkel als tiebreaker
+		return float64(daemon.Workers) + daemon.Latency.Seconds()/1000
+	}
+
+	// Verwachte wachttijd: aantal workers vermenigvuldigd met de latency,
+	// daemons die vaak falen worden zwaar afgestraft
+	latency := daemon.Latency.Seconds()
+	if latency < 0.1 {
+		latency = 0.1
+	}
+	return float64(daemon.Workers+1) * latency / (1.01 - daemon.ErrorRate)
 }
 
 func (dist *Tor) GetClient() *http.Client {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
 	if dist.Used >= dist.Count {
 		return nil
 	}
-	dist.Used++
 
-	client := dist.Clients.Pop()
-	dist.Clients.Push(client)
+	var best *TorDaemon
+	var bestLoad float64
+	for _, daemon := range dist.Daemons {
+		if !daemon.Healthy {
+			continue
+		}
+
+		load := dist.load(daemon)
+		if best == nil || load < bestLoad {
+			best = daemon
+			bestLoad = load
+		}
+	}
 
-	return client
+	if best == nil {
+		// Geen enkele gezonde daemon
+		return nil
+	}
+
+	dist.Used++
+	best.Workers++
+	return best.Client
 }
 
 func (dist *Tor) FreeClient(client *http.Client) {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
 	dist.Used--
+	if daemon := dist.daemonForClient(client); daemon != nil {
+		daemon.Workers--
+	}
+}
+
+// Geeft de statistieken per daemon terug en zet de tellers terug op nul
+func (dist *Tor) CollectClientStats() []*queries.ClientStats {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
+	stats := make([]*queries.ClientStats, 0, len(dist.Daemons))
+	for _, daemon := range dist.Daemons {
+		stats = append(stats, &queries.ClientStats{
+			Address:      daemon.String(),
+			Healthy:      daemon.Healthy,
+			Bootstrapped: daemon.Bootstrapped,
+			Workers:      daemon.Workers,
+			InFlight:     daemon.InFlight,
+			Requests:     daemon.Requests,
+			Errors:       daemon.Errors,
+			Latency:      int(daemon.Latency.Seconds() * 1000),
+			ErrorRate:    daemon.ErrorRate,
+			Restarts:     daemon.Restarts,
+		})
+		daemon.Requests = 0
+		daemon.Errors = 0
+	}
+	return stats
 }
 
 func (dist *Tor) DecreaseClients() {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
 	dist.Count = int(float64(dist.Count) * 0.8)
 	if dist.Count < 1 {
 		dist.Count = 1
@@ -104,6 +473,9 @@ func (dist *Tor) DecreaseClients() {
 }
 
 func (dist *Tor) IncreaseClients() {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
+
 	dist.Count += int(math.Ceil(float64(dist.Count) * 0.05))
 	if dist.Count > dist.MaxCount {
 		dist.Count = dist.MaxCount
@@ -111,10 +483,14 @@ func (dist *Tor) IncreaseClients() {
 }
 
 func (dist *Tor) AvailableClients() int {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
 	return dist.Count - dist.Used
 }
 
 func (dist *Tor) UsedClients() int {
+	dist.mutex.Lock()
+	defer dist.mutex.Unlock()
 	return dist.Used
 }
 
@@ -0,0 +1,96 @@
+package distributors
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+)
+
+// Een tor daemon die door de crawler zelf werd opgestart. De daemon draait
+// in de voorgrond zodat we kunnen detecteren wanneer die stopt.
+type TorProcess struct {
+	SocksPort     int
+	ControlPort   int
+	DataDirectory string
+	StartedAt     time.Time
+
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+func NewTorProcess(socksPort, controlPort int, dataDirectory string) *TorProcess {
+	return &TorProcess{SocksPort: socksPort, ControlPort: controlPort, DataDirectory: dataDirectory}
+}
+
+func (p *TorProcess) Endpoint() SocksEndpoint {
+	return SocksEndpoint{
+		Address:           fmt.Sprintf("127.0.0.1:%v", p.SocksPort),
+		ControlAddress:    fmt.Sprintf("127.0.0.1:%v", p.ControlPort),
+		ControlCookieFile: path.Join(p.DataDirectory, "control_auth_cookie"),
+	}
+}
+
+func (p *TorProcess) Start() error {
+	if err := os.MkdirAll(p.DataDirectory, 0700); err != nil {
+		return err
+	}
+
+	//tor --SocksPort 9150 --ControlPort 9170 --DataDirectory "/tor_dir/tor1" --CookieAuthentication 1 --ClientOnly 1
+	cmd := exec.Command("tor",
+		"--SocksPort", fmt.Sprintf("%v", p.SocksPort),
+		"--ControlPort", fmt.Sprintf("%v", p.ControlPort),
+		"--DataDirectory", p.DataDirectory,
+
+		// Enkel processen die het cookie bestand kunnen lezen krijgen toegang tot de control port
+		"--CookieAuthentication", "1",
+
+		// Disable routing
+		"--ClientOnly", "1",
+		//"--MaxCircuitDirtiness", "300", // Maximum seconden om tor circuit te hergebruiken
+		//"--OnionTrafficOnly", "1", (unsupported)
+		//"--SafeSocks", "1", // Voorkom dns leaks (aanvragen met al geresolvede dns worden genegeerd)
+	)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%q failed: %v", "tor", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	p.cmd = cmd
+	p.exited = exited
+	p.StartedAt = time.Now()
+	return nil
+}
+
+func (p *TorProcess) Exited() bool {
+	if p.exited == nil {
+		return true
+	}
+
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *TorProcess) Stop() {
+	if p.Exited() {
+		return
+	}
+	p.cmd.Process.Kill()
+	<-p.exited
+}
+
+func (p *TorProcess) Restart() error {
+	p.Stop()
+	return p.Start()
+}
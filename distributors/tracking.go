@@ -0,0 +1,51 @@
+package distributors
+
+import (
+	"net/http"
+	"time"
+)
+
+// Gewicht van een nieuwe meting in de voortschrijdende gemiddelden
+const trackingAlpha = 0.1
+
+// RoundTripper die latency en fouten van elke request bijhoudt voor een daemon
+type trackingTransport struct {
+	dist      *Tor
+	daemon    *TorDaemon
+	transport *http.Transport
+}
+
+func (t *trackingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.dist.mutex.Lock()
+	t.daemon.InFlight++
+	t.dist.mutex.Unlock()
+
+	start := time.Now()
+	response, err := t.transport.RoundTrip(request)
+	duration := time.Since(start)
+
+	t.dist.mutex.Lock()
+	t.daemon.InFlight--
+	t.daemon.Requests++
+
+	var failed float64
+	if err != nil {
+		t.daemon.Errors++
+		failed = 1
+	} else {
+		// Enkel geslaagde requests zeggen iets over de snelheid tot de headers
+		if t.daemon.Latency == 0 {
+			t.daemon.Latency = duration
+		} else {
+			t.daemon.Latency = time.Duration(float64(t.daemon.Latency)*(1-trackingAlpha) + float64(duration)*trackingAlpha)
+		}
+	}
+	t.daemon.ErrorRate = t.daemon.ErrorRate*(1-trackingAlpha) + failed*trackingAlpha
+	t.dist.mutex.Unlock()
+
+	return response, err
+}
+
+func (t *trackingTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
@@ -0,0 +1,16 @@
+package queries
+
+// Url's en inhoud die nooit gecrawld of opgeslagen mogen worden. Hosts en inhoud
+// staan er enkel als SHA-256 hash (hex) in, zo is de lijst zelf geen linklijst.
+type Blocklist struct {
+	Hosts    []string `json:"hosts,omitempty" bson:"hosts,omitempty"`
+	Patterns []string `json:"patterns,omitempty" bson:"patterns,omitempty"`
+	Content  []string `json:"content,omitempty" bson:"content,omitempty"`
+}
+
+// Aantal geweigerde url's en pagina's sinds de vorige statistieken
+type BlocklistStats struct {
+	Hosts    int `json:"hosts" bson:"hosts"`
+	Patterns int `json:"patterns" bson:"patterns"`
+	Content  int `json:"content" bson:"content"`
+}
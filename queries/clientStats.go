@@ -0,0 +1,15 @@
+package queries
+
+// Statistieken van één client van de distributor (bv. een tor daemon)
+type ClientStats struct {
+	Address      string  `json:"address" bson:"address"`
+	Healthy      bool    `json:"healthy" bson:"healthy"`
+	Bootstrapped int     `json:"bootstrapped" bson:"bootstrapped"`
+	Workers      int     `json:"workers" bson:"workers"`
+	InFlight     int     `json:"inFlight" bson:"inFlight"`
+	Requests     int     `json:"requests" bson:"requests"`
+	Errors       int     `json:"errors" bson:"errors"`
+	Latency      int     `json:"latency" bson:"latency"` // ms
+	ErrorRate    float64 `json:"errorRate" bson:"errorRate"`
+	Restarts     int     `json:"restarts" bson:"restarts"`
+}
@@ -0,0 +1,21 @@
+package queries
+
+// Regels die bepalen welke url's van een host gecrawld mogen worden.
+// Zonder Host geldt de regel voor alle hosts.
+type CrawlRule struct {
+	Host string `json:"host,omitempty" bson:"host,omitempty"`
+
+	// Regexps op het pad. Als Include niet leeg is, moet het pad op minstens één ervan passen
+	Include []string `json:"include,omitempty" bson:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty" bson:"exclude,omitempty"`
+
+	// Url's met deze query parameters niet crawlen: "naam" of "naam=waarde"
+	ExcludeParams []string `json:"excludeParams,omitempty" bson:"excludeParams,omitempty"`
+
+	// Maximale diepte van items (0 = standaard). Een regel voor een host gaat voor op een globale regel
+	MaxDepth int `json:"maxDepth,omitempty" bson:"maxDepth,omitempty"`
+
+	// Gewicht van de host bij het kiezen van de volgende worker, toegekend door
+	// een analist (0 = standaard). Enkel voor regels met een Host
+	Weight float64 `json:"weight,omitempty" bson:"weight,omitempty"`
+}
@@ -0,0 +1,61 @@
+package queries
+
+import (
+	"time"
+)
+
+// Patroon van url's dat niet meer gecrawld wordt (crawler trap)
+type QuarantinedPattern struct {
+	Pattern  string    `json:"pattern" bson:"pattern"`
+	Reason   string    `json:"reason" bson:"reason"`
+	Since    time.Time `json:"since" bson:"since"`
+	Until    time.Time `json:"until" bson:"until"` // Nul als de quarantaine niet verloopt
+	Rejected int       `json:"rejected" bson:"rejected"`
+}
+
+// Statistieken van één host, verstuurd als een worker stopt
+type HostStats struct {
+	Host  string    `json:"host" bson:"host"`
+	Date  time.Time `json:"date" bson:"date"`
+	Items int       `json:"items" bson:"items"`
+
+	// Items waarvan enkel een hash bijgehouden wordt (inbegrepen in Items)
+	Compacted int `json:"compacted,omitempty" bson:"compacted,omitempty"`
+
+	// Url's geweigerd door trap detectie zonder patroon (herhaalde segmenten, te veel parameters)
+	TrapRejected int                   `json:"trapRejected" bson:"trapRejected"`
+	Quarantined  []*QuarantinedPattern `json:"quarantined,omitempty" bson:"quarantined,omitempty"`
+
+	// Snelheid van de host (requests per seconde), gemiddelde latency in ms
+	// en het aantal 429/503 antwoorden
+	Rate      float64 `json:"rate" bson:"rate"`
+	Latency   int     `json:"latency" bson:"latency"`
+	Throttled int     `json:"throttled" bson:"throttled"`
+
+	// Pagina's met gewijzigde inhoud en pagina's die een cycle overgeslagen werden
+	// omdat ze volgens hun wijzigingsinterval nog niet opnieuw moesten
+	Changed        int `json:"changed" bson:"changed"`
+	RecrawlSkipped int `json:"recrawlSkipped" bson:"recrawlSkipped"`
+
+	// Aantal url's geweigerd per include/exclude regel
+	RuleRejected map[string]int `json:"ruleRejected,omitempty" bson:"ruleRejected,omitempty"`
+
+	// Verbruik van het crawl budget (enkel als er een budget ingesteld is)
+	Budget *BudgetStats `json:"budget,omitempty" bson:"budget,omitempty"`
+}
+
+// Verbruikte pagina's, bytes en seconden in de huidige cycle en vandaag,
+// en welk budget op is (leeg als de host nog verder mag)
+type BudgetStats struct {
+	CyclePages int    `json:"cyclePages" bson:"cyclePages"`
+	CycleBytes int64  `json:"cycleBytes" bson:"cycleBytes"`
+	CycleTime  int    `json:"cycleTime" bson:"cycleTime"`
+	DayPages   int    `json:"dayPages" bson:"dayPages"`
+	DayBytes   int64  `json:"dayBytes" bson:"dayBytes"`
+	DayTime    int    `json:"dayTime" bson:"dayTime"`
+	Exhausted  string `json:"exhausted,omitempty" bson:"exhausted,omitempty"`
+}
+
+func NewHostStats(host string) *HostStats {
+	return &HostStats{Host: host, Date: time.Now()}
+}
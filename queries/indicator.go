@@ -0,0 +1,40 @@
+package queries
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// Soorten indicators
+const (
+	IndicatorBitcoin        = "bitcoin"
+	IndicatorMonero         = "monero"
+	IndicatorEthereum       = "ethereum"
+	IndicatorEmail          = "email"
+	IndicatorPgpKey         = "pgp-key"
+	IndicatorPgpFingerprint = "pgp-fingerprint"
+	IndicatorJabber         = "jabber"
+	IndicatorTelegram       = "telegram"
+	IndicatorWickr          = "wickr"
+)
+
+// Gestructureerde, gevalideerde gegevens die op een pagina gevonden werden
+type Indicator struct {
+	Id    bson.ObjectId `json:"_id,omitempty" bson:"_id,omitempty"`
+	Type  string        `json:"type" bson:"type"`
+	Value string        `json:"value" bson:"value"`
+
+	LastFound   time.Time `json:"lastFound" bson:"lastFound"`
+	CreatedOn   time.Time `json:"createdOn" bson:"createdOn"`
+	Occurrences int       `json:"occurrences" bson:"occurrences"`
+	Url         *string   `json:"url" bson:"url"`
+	Host        *string   `json:"host" bson:"host"`
+	Title       *string   `json:"title" bson:"title"`
+
+	// Tekst rond de eerste vermelding op de pagina
+	Context *string `json:"context" bson:"context"`
+}
+
+func NewIndicator(indicatorType, value string, context *string) *Indicator {
+	return &Indicator{Type: indicatorType, Value: value, LastFound: time.Now(), CreatedOn: time.Now(), Occurrences: 1, Context: context}
+}
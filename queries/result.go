@@ -18,6 +18,7 @@ type Result struct {
 	Host        *string   `json:"host" bson:"host"`
 	Snippet     *string   `json:"snippet" bson:"snippet"`
 	Category    string    `json:"category" bson:"category"`
+	Charset     string    `json:"charset,omitempty" bson:"charset,omitempty"`
 }
 
 func NewResult(query Query, url, host, body, title, snippet *string) *Result {
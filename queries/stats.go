@@ -15,6 +15,13 @@ type Stats struct {
 	DownloadSize  int       `json:"downloadSize" bson:"downloadSize"`
 	MemoryAlloc   uint64    `json:"memoryAlloc" bson:"memoryAlloc"`
 	MemorySys     uint64    `json:"memorySys" bson:"memorySys"`
+
+	// Recrawls zonder nieuwe inhoud
+	NotModified int `json:"notModified,omitempty" bson:"notModified,omitempty"`
+	Unchanged   int `json:"unchanged,omitempty" bson:"unchanged,omitempty"`
+
+	Clients []*ClientStats  `json:"clients,omitempty" bson:"clients,omitempty"`
+	Blocked *BlocklistStats `json:"blocked,omitempty" bson:"blocked,omitempty"`
 }
 
 func NewStats(requests, timeouts, workers, domains, downloadSpeed, downloadTime, downloadSize int, memoryAlloc, memorySys uint64) *Stats {